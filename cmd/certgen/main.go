@@ -0,0 +1,223 @@
+// Command certgen manages the internal CA used for mutual TLS between the
+// gateway and the services.
+//
+// Usage:
+//
+//	certgen ca [-dir certs] [-days 3650]
+//	certgen cert -name users [-hosts users-service,localhost] [-dir certs] [-days 365]
+//
+// "ca" creates ca.pem and ca-key.pem. "cert" creates <name>.pem and
+// <name>-key.pem signed by the CA, valid both as a server and as a client
+// certificate.
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// organization is set on every generated certificate
+const organization = "go-inventory-system"
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "ca":
+		err = runCA(os.Args[2:])
+	case "cert":
+		err = runCert(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "certgen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// usage prints the available commands and exits
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: certgen ca [-dir certs] [-days 3650] [-force]")
+	fmt.Fprintln(os.Stderr, "       certgen cert -name NAME [-hosts HOST,...] [-dir certs] [-days 365]")
+	os.Exit(2)
+}
+
+// runCA creates a self-signed CA certificate and key
+func runCA(args []string) error {
+	flags := flag.NewFlagSet("ca", flag.ExitOnError)
+	dir := flags.String("dir", "certs", "directory to write ca.pem and ca-key.pem to")
+	days := flags.Int("days", 3650, "validity in days")
+	force := flags.Bool("force", false, "replace an existing CA")
+	flags.Parse(args)
+
+	certFile, keyFile := filepath.Join(*dir, "ca.pem"), filepath.Join(*dir, "ca-key.pem")
+	if _, err := os.Stat(keyFile); err == nil && !*force {
+		return fmt.Errorf("%s already exists; use -force to replace it and every certificate it signed", keyFile)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	template, err := newTemplate(organization+" CA", *days)
+	if err != nil {
+		return err
+	}
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.MaxPathLenZero = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	if err := writeFiles(*dir, certFile, keyFile, der, key); err != nil {
+		return err
+	}
+	fmt.Printf("Created %s and %s\n", certFile, keyFile)
+	return nil
+}
+
+// runCert creates a certificate for a service, signed by the CA
+func runCert(args []string) error {
+	flags := flag.NewFlagSet("cert", flag.ExitOnError)
+	name := flags.String("name", "", "service name, used as common name and file name")
+	hosts := flags.String("hosts", "", "comma-separated DNS names and IP addresses (default: the name)")
+	dir := flags.String("dir", "certs", "directory holding the CA and receiving the certificate")
+	days := flags.Int("days", 365, "validity in days")
+	flags.Parse(args)
+
+	if *name == "" {
+		return errors.New("-name is required")
+	}
+	if strings.ContainsAny(*name, `/\`) {
+		return fmt.Errorf("invalid name %q", *name)
+	}
+
+	caCert, caKey, err := loadCA(*dir)
+	if err != nil {
+		return err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	template, err := newTemplate(*name, *days)
+	if err != nil {
+		return err
+	}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+
+	hostList := *hosts
+	if hostList == "" {
+		hostList = *name
+	}
+	for _, host := range strings.Split(hostList, ",") {
+		host = strings.TrimSpace(host)
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if host != "" {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return err
+	}
+	certFile, keyFile := filepath.Join(*dir, *name+".pem"), filepath.Join(*dir, *name+"-key.pem")
+	if err := writeFiles(*dir, certFile, keyFile, der, key); err != nil {
+		return err
+	}
+	fmt.Printf("Created %s and %s\n", certFile, keyFile)
+	return nil
+}
+
+// newTemplate creates a certificate template valid from now for days
+func newTemplate(commonName string, days int) (*x509.Certificate, error) {
+	if days <= 0 {
+		return nil, errors.New("-days must be positive")
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{organization}},
+		// Allow for clock skew between machines
+		NotBefore: now.Add(-time.Hour),
+		NotAfter:  now.AddDate(0, 0, days),
+	}, nil
+}
+
+// loadCA reads the CA certificate and key from dir
+func loadCA(dir string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certPEM, err := os.ReadFile(filepath.Join(dir, "ca.pem"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("read CA certificate (run certgen ca first): %w", err)
+	}
+	keyPEM, err := os.ReadFile(filepath.Join(dir, "ca-key.pem"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("read CA key: %w", err)
+	}
+
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil {
+		return nil, nil, errors.New("invalid CA certificate")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse CA certificate: %w", err)
+	}
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, nil, errors.New("invalid CA key")
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse CA key: %w", err)
+	}
+	return cert, key, nil
+}
+
+// writeFiles writes a certificate and its private key as PEM. The key is
+// only readable by its owner.
+func writeFiles(dir, certFile, keyFile string, der []byte, key *ecdsa.PrivateKey) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(certFile, certPEM, 0o644); err != nil {
+		return err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return os.WriteFile(keyFile, keyPEM, 0o600)
+}
@@ -0,0 +1,306 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"go-inventory-system/gateway/cache"
+	"go-inventory-system/gateway/middleware"
+	"go-inventory-system/gateway/router"
+	"go-inventory-system/gateway/upstream"
+	"go-inventory-system/shared"
+)
+
+// Gateway provides the runtime state and controls of the gateway
+type Gateway interface {
+	Routes() []shared.Route
+	UpstreamStats() map[string][]upstream.Stats
+	Version() router.ConfigVersion
+	SetDrained(route, upstreamURL string, drained bool) error
+}
+
+// RateLimiter provides the state of the gateway rate limiter
+type RateLimiter interface {
+	Stats() middleware.RateLimiterStats
+}
+
+// Cache provides the state of the response cache and purges it
+type Cache interface {
+	Stats() cache.Stats
+	Purge(key string) int
+	PurgePrefix(prefix string) int
+}
+
+// Credentials protect the admin API with HTTP basic auth
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// Handler serves the gateway admin API
+type Handler struct {
+	gateway     Gateway
+	rateLimiter RateLimiter
+	cache       Cache
+	reload      func() error
+	credentials Credentials
+	mux         *http.ServeMux
+}
+
+// RouteInfo summarizes an active route
+type RouteInfo struct {
+	Name      string            `json:"name"`
+	Path      string            `json:"path"`
+	Host      string            `json:"host,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Query     map[string]string `json:"query,omitempty"`
+	Methods   []string          `json:"methods"`
+	Upstreams []string          `json:"upstreams,omitempty"`
+	Variants  map[string]int    `json:"variants,omitempty"`
+	Mirror    string            `json:"mirror,omitempty"`
+}
+
+// BreakerInfo is the circuit breaker state of an upstream
+type BreakerInfo struct {
+	Upstream string `json:"upstream"`
+	State    string `json:"state"`
+}
+
+// PurgeRequest selects cached responses to remove: the resource with the
+// given key, or every resource whose key starts with prefix. All empties
+// the cache.
+type PurgeRequest struct {
+	Key    string `json:"key,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+	All    bool   `json:"all,omitempty"`
+}
+
+// PurgeResult reports how many cached responses a purge removed
+type PurgeResult struct {
+	Purged int `json:"purged"`
+}
+
+// DrainRequest names an upstream of a route to drain or enable
+type DrainRequest struct {
+	Route string `json:"route" validate:"required"`
+	URL   string `json:"url" validate:"required"`
+}
+
+// NewHandler creates a new admin handler. reload reloads the routes file.
+func NewHandler(gateway Gateway, rateLimiter RateLimiter, cache Cache, reload func() error, credentials Credentials) *Handler {
+	handler := &Handler{
+		gateway:     gateway,
+		rateLimiter: rateLimiter,
+		cache:       cache,
+		reload:      reload,
+		credentials: credentials,
+		mux:         http.NewServeMux(),
+	}
+
+	handler.mux.HandleFunc("/admin/routes", handler.Routes)
+	handler.mux.HandleFunc("/admin/upstreams", handler.Upstreams)
+	handler.mux.HandleFunc("/admin/upstreams/drain", handler.Drain)
+	handler.mux.HandleFunc("/admin/upstreams/enable", handler.Enable)
+	handler.mux.HandleFunc("/admin/breakers", handler.Breakers)
+	handler.mux.HandleFunc("/admin/ratelimiter", handler.RateLimiter)
+	handler.mux.HandleFunc("/admin/cache", handler.Cache)
+	handler.mux.HandleFunc("/admin/cache/purge", handler.Purge)
+	handler.mux.HandleFunc("/admin/config", handler.Config)
+	handler.mux.HandleFunc("/admin/reload", handler.Reload)
+	return handler
+}
+
+// ServeHTTP implements http.Handler, requiring the admin credentials
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	username, password, ok := r.BasicAuth()
+	if !ok || !h.authorized(username, password) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="gateway admin"`)
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusUnauthorized, shared.ErrCodeUnauthorized, "Admin credentials required"))
+		return
+	}
+
+	h.mux.ServeHTTP(w, r)
+}
+
+// authorized compares credentials in constant time
+func (h *Handler) authorized(username, password string) bool {
+	usernameOK := subtle.ConstantTimeCompare([]byte(username), []byte(h.credentials.Username)) == 1
+	passwordOK := subtle.ConstantTimeCompare([]byte(password), []byte(h.credentials.Password)) == 1
+	return usernameOK && passwordOK
+}
+
+// Routes returns a summary of the active routes
+func (h *Handler) Routes(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	routes := h.gateway.Routes()
+	infos := make([]RouteInfo, len(routes))
+	for i, route := range routes {
+		info := RouteInfo{
+			Name:    route.ID(),
+			Path:    route.Path,
+			Host:    route.Match.Host,
+			Headers: route.Match.Headers,
+			Query:   route.Match.Query,
+			Methods: route.Methods,
+			Mirror:  route.Mirror.URL,
+		}
+		for _, u := range route.AllUpstreams() {
+			info.Upstreams = append(info.Upstreams, u.URL)
+		}
+		if len(route.Split.Variants) > 0 {
+			info.Variants = make(map[string]int)
+			for _, v := range route.Split.Variants {
+				info.Variants[v.Name] = v.Weight
+			}
+		}
+		infos[i] = info
+	}
+
+	shared.WriteSuccessResponse(w, http.StatusOK, "Routes retrieved successfully", infos)
+}
+
+// Upstreams returns health and connection stats for every upstream, keyed by route
+func (h *Handler) Upstreams(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	shared.WriteSuccessResponse(w, http.StatusOK, "Upstreams retrieved successfully", h.gateway.UpstreamStats())
+}
+
+// Drain takes an upstream out of rotation without interrupting requests in flight
+func (h *Handler) Drain(w http.ResponseWriter, r *http.Request) {
+	h.setDrained(w, r, true)
+}
+
+// Enable puts a drained upstream back into rotation
+func (h *Handler) Enable(w http.ResponseWriter, r *http.Request) {
+	h.setDrained(w, r, false)
+}
+
+// setDrained applies a drain or enable request
+func (h *Handler) setDrained(w http.ResponseWriter, r *http.Request, drained bool) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req DrainRequest
+	if err := shared.DecodeJSON(r, &req); err != nil {
+		shared.WriteDecodeError(w, r, err)
+		return
+	}
+
+	if err := h.gateway.SetDrained(req.Route, req.URL, drained); err != nil {
+		if errors.Is(err, router.ErrNotFound) {
+			shared.WriteError(w, r, shared.NewAPIError(http.StatusNotFound, shared.ErrCodeNotFound, err.Error()))
+			return
+		}
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to update upstream"))
+		return
+	}
+
+	message := "Upstream enabled"
+	if drained {
+		message = "Upstream drained"
+	}
+	shared.WriteSuccessResponse(w, http.StatusOK, message, req)
+}
+
+// Breakers returns the circuit breaker state of every upstream, keyed by route
+func (h *Handler) Breakers(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	breakers := make(map[string][]BreakerInfo)
+	for route, stats := range h.gateway.UpstreamStats() {
+		for _, s := range stats {
+			breakers[route] = append(breakers[route], BreakerInfo{Upstream: s.URL, State: s.CircuitState})
+		}
+	}
+
+	shared.WriteSuccessResponse(w, http.StatusOK, "Circuit breakers retrieved successfully", breakers)
+}
+
+// RateLimiter returns the rate limiter state
+func (h *Handler) RateLimiter(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	shared.WriteSuccessResponse(w, http.StatusOK, "Rate limiter retrieved successfully", h.rateLimiter.Stats())
+}
+
+// Cache returns the size of the response cache
+func (h *Handler) Cache(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	shared.WriteSuccessResponse(w, http.StatusOK, "Cache stats retrieved successfully", h.cache.Stats())
+}
+
+// Purge removes responses from the cache by key or key prefix
+func (h *Handler) Purge(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	var req PurgeRequest
+	if err := shared.DecodeJSON(r, &req); err != nil {
+		shared.WriteDecodeError(w, r, err)
+		return
+	}
+
+	var purged int
+	switch {
+	case req.All:
+		purged = h.cache.PurgePrefix("")
+	case req.Key != "" && req.Prefix == "":
+		purged = h.cache.Purge(req.Key)
+	case req.Prefix != "" && req.Key == "":
+		purged = h.cache.PurgePrefix(req.Prefix)
+	default:
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusBadRequest, shared.ErrCodeBadRequest, "Exactly one of key, prefix or all is required"))
+		return
+	}
+
+	shared.WriteSuccessResponse(w, http.StatusOK, "Cache purged", PurgeResult{Purged: purged})
+}
+
+// Config returns the version of the active routing configuration
+func (h *Handler) Config(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+
+	shared.WriteSuccessResponse(w, http.StatusOK, "Config version retrieved successfully", h.gateway.Version())
+}
+
+// Reload reloads the routes file. The current routes stay active if the file is invalid.
+func (h *Handler) Reload(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodPost) {
+		return
+	}
+
+	if err := h.reload(); err != nil {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusUnprocessableEntity, shared.ErrCodeInvalidConfig, err.Error()))
+		return
+	}
+
+	shared.WriteSuccessResponse(w, http.StatusOK, "Routes reloaded", h.gateway.Version())
+}
+
+// requireMethod writes a 405 error unless the request uses method
+func requireMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Method not allowed"))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,277 @@
+package cache
+
+import (
+	"container/list"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache is a size-bounded LRU store of backend responses shared by all
+// routes. Responses are grouped by resource: a route and request URI, plus
+// the split variant and the user for per-user routes. A resource holds one variant per combination
+// of the request headers named in its Vary header.
+type Cache struct {
+	maxBytes      int64
+	maxEntryBytes int64
+
+	mu        sync.Mutex
+	size      int64
+	entries   map[string]*list.Element
+	resources map[string]*resource
+	// lru orders entries from most to least recently used
+	lru *list.List
+}
+
+// resource tracks the stored variants of a resource
+type resource struct {
+	vary     []string
+	variants map[string]struct{}
+}
+
+// entry is a stored response. Entries are immutable; revalidation stores a
+// new entry in place of the old one.
+type entry struct {
+	key      string
+	resource string
+	status   int
+	header   http.Header
+	body     []byte
+	storedAt time.Time
+	expires  time.Time
+	// age is the Age the backend reported when the response was stored
+	age time.Duration
+}
+
+// Stats describes the contents of the cache
+type Stats struct {
+	Entries   int   `json:"entries"`
+	Resources int   `json:"resources"`
+	Bytes     int64 `json:"bytes"`
+	MaxBytes  int64 `json:"max_bytes"`
+}
+
+// New creates a cache holding up to maxBytes of responses, none larger
+// than maxEntryBytes
+func New(maxBytes, maxEntryBytes int64) *Cache {
+	return &Cache{
+		maxBytes:      maxBytes,
+		maxEntryBytes: maxEntryBytes,
+		entries:       make(map[string]*list.Element),
+		resources:     make(map[string]*resource),
+		lru:           list.New(),
+	}
+}
+
+// get returns the stored variant of a resource matching req
+func (c *Cache) get(resourceKey string, req *http.Request) *entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	res, ok := c.resources[resourceKey]
+	if !ok {
+		return nil
+	}
+	elem, ok := c.entries[variantKey(resourceKey, res.vary, req)]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*entry)
+}
+
+// put stores a response, evicting the least recently used entries to make room
+func (c *Cache) put(e *entry, vary []string) {
+	size := e.size()
+	if size > c.maxEntryBytes || size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	res, ok := c.resources[e.resource]
+	if ok && !equalFold(res.vary, vary) {
+		// Variants stored under the old Vary headers can no longer be found
+		c.removeResource(e.resource)
+		ok = false
+	}
+	if !ok {
+		res = &resource{vary: vary, variants: make(map[string]struct{})}
+		c.resources[e.resource] = res
+	}
+
+	if elem, ok := c.entries[e.key]; ok {
+		c.size -= elem.Value.(*entry).size()
+		elem.Value = e
+		c.lru.MoveToFront(elem)
+	} else {
+		c.entries[e.key] = c.lru.PushFront(e)
+		res.variants[e.key] = struct{}{}
+	}
+	c.size += size
+
+	for c.size > c.maxBytes {
+		c.remove(c.lru.Back())
+		cacheEvictionsTotal.Inc()
+	}
+	c.updateGauges()
+}
+
+// Purge removes every variant of the resource with the given key and
+// returns the number of entries removed
+func (c *Cache) Purge(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := c.removeResource(key)
+	c.updateGauges()
+	return removed
+}
+
+// purgePaths removes the resources of paths, given as keys without query,
+// for every query string, split variant and user
+func (c *Cache) purgePaths(paths []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.resources {
+		for _, path := range paths {
+			if matchesPath(key, path) {
+				c.removeResource(key)
+				break
+			}
+		}
+	}
+	c.updateGauges()
+}
+
+// matchesPath reports whether a resource key belongs to path, with or
+// without a trailing slash
+func matchesPath(key, path string) bool {
+	rest, ok := strings.CutPrefix(key, path)
+	if !ok {
+		return false
+	}
+	rest = strings.TrimPrefix(rest, "/")
+	return rest == "" || rest[0] == '?' || rest[0] == ' '
+}
+
+// PurgePrefix removes every resource whose key starts with prefix and
+// returns the number of entries removed. An empty prefix empties the cache.
+func (c *Cache) PurgePrefix(prefix string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	for key := range c.resources {
+		if strings.HasPrefix(key, prefix) {
+			removed += c.removeResource(key)
+		}
+	}
+	c.updateGauges()
+	return removed
+}
+
+// Stats returns the current size of the cache
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Stats{
+		Entries:   len(c.entries),
+		Resources: len(c.resources),
+		Bytes:     c.size,
+		MaxBytes:  c.maxBytes,
+	}
+}
+
+// removeResource removes a resource and all its variants. c.mu must be held.
+func (c *Cache) removeResource(key string) int {
+	res, ok := c.resources[key]
+	if !ok {
+		return 0
+	}
+
+	removed := len(res.variants)
+	for variant := range res.variants {
+		c.remove(c.entries[variant])
+	}
+	return removed
+}
+
+// remove removes an entry, and its resource once no variants are left.
+// c.mu must be held.
+func (c *Cache) remove(elem *list.Element) {
+	e := elem.Value.(*entry)
+	c.lru.Remove(elem)
+	delete(c.entries, e.key)
+	c.size -= e.size()
+
+	if res, ok := c.resources[e.resource]; ok {
+		delete(res.variants, e.key)
+		if len(res.variants) == 0 {
+			delete(c.resources, e.resource)
+		}
+	}
+}
+
+// updateGauges publishes the cache size. c.mu must be held.
+func (c *Cache) updateGauges() {
+	cacheEntries.Set(float64(len(c.entries)))
+	cacheBytes.Set(float64(c.size))
+}
+
+// size approximates the memory held by an entry
+func (e *entry) size() int64 {
+	size := len(e.key) + len(e.body)
+	for name, values := range e.header {
+		size += len(name)
+		for _, value := range values {
+			size += len(value)
+		}
+	}
+	return int64(size)
+}
+
+// currentAge returns how old the response is, including time spent in
+// caches before the gateway
+func (e *entry) currentAge(now time.Time) time.Duration {
+	return e.age + now.Sub(e.storedAt)
+}
+
+// fresh reports whether the entry can be served without revalidation
+func (e *entry) fresh(now time.Time) bool {
+	return now.Before(e.expires)
+}
+
+// variantKey identifies the variant of a resource selected by req
+func variantKey(resourceKey string, vary []string, req *http.Request) string {
+	if len(vary) == 0 {
+		return resourceKey
+	}
+
+	var b strings.Builder
+	b.WriteString(resourceKey)
+	for _, name := range vary {
+		b.WriteByte('\n')
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(strings.Join(req.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+// equalFold reports whether two lists of header names are the same
+func equalFold(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !strings.EqualFold(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
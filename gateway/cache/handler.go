@@ -0,0 +1,267 @@
+package cache
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-inventory-system/gateway/upstream"
+	"go-inventory-system/shared"
+)
+
+// Cache results, reported in the X-Cache response header and in metrics
+const (
+	resultHit         = "HIT"
+	resultMiss        = "MISS"
+	resultRevalidated = "REVALIDATED"
+	resultBypass      = "BYPASS"
+
+	cacheHeader = "X-Cache"
+)
+
+// Wrap returns a handler serving a route's GET requests from the cache and
+// filling it from next. Routes without caching enabled get next unchanged.
+func (c *Cache) Wrap(route shared.Route, next http.Handler) http.Handler {
+	if c == nil || !route.Cache.Enabled {
+		return next
+	}
+
+	p := newPolicy(route)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		c.serve(p, next, w, req)
+	})
+}
+
+// serve answers a request from the cache when a fresh response is stored,
+// and otherwise fetches it from next
+func (c *Cache) serve(p policy, next http.Handler, w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet || upstream.IsStream(req) {
+		next.ServeHTTP(w, req)
+		if req.Method != http.MethodHead && req.Method != http.MethodOptions {
+			c.invalidate(p, req)
+		}
+		return
+	}
+
+	// Authenticated responses are only cached per user, keyed by the
+	// verified user ID
+	personal := req.Header.Get("Authorization") != ""
+	user := ""
+	if personal && p.perUser {
+		user = upstream.UserID(req)
+	}
+
+	requestCC := parseCacheControl(req.Header.Values("Cache-Control"))
+	if requestCC.has("no-store") || (personal && user == "") {
+		cacheRequestsTotal.WithLabelValues(p.route, resultBypass).Inc()
+		w.Header().Set(cacheHeader, resultBypass)
+		next.ServeHTTP(w, req)
+		return
+	}
+
+	key := p.resourceKey(req, user)
+	cached := c.get(key, req)
+	now := time.Now()
+	if cached != nil && cached.fresh(now) && !requestCC.has("no-cache") {
+		maxAge, limited := requestCC.seconds("max-age")
+		if !limited || cached.currentAge(now) <= maxAge {
+			cacheRequestsTotal.WithLabelValues(p.route, resultHit).Inc()
+			respond(w, req, cached, resultHit, now)
+			return
+		}
+	}
+
+	result := c.fetch(p, next, w, req, key, personal, cached)
+	cacheRequestsTotal.WithLabelValues(p.route, result).Inc()
+}
+
+// invalidate removes the cached responses of a resource changed by an unsafe
+// request and of the collection containing it, so that /users is refreshed
+// after a write to /users/5
+func (c *Cache) invalidate(p policy, req *http.Request) {
+	c.purgePaths(p.writtenPaths(req))
+}
+
+// fetch forwards a request to next, revalidating the cached response if
+// there is one, and stores the response if it is cacheable
+func (c *Cache) fetch(p policy, next http.Handler, w http.ResponseWriter, req *http.Request, key string, personal bool, cached *entry) string {
+	// The client's validators are answered by the gateway, so the backend
+	// is asked for a full response or to confirm the cached one
+	out := req.Clone(req.Context())
+	out.Header.Del("If-None-Match")
+	out.Header.Del("If-Modified-Since")
+
+	revalidating := false
+	if cached != nil {
+		if etag := cached.header.Get("ETag"); etag != "" {
+			out.Header.Set("If-None-Match", etag)
+			revalidating = true
+		} else if modified := cached.header.Get("Last-Modified"); modified != "" {
+			out.Header.Set("If-Modified-Since", modified)
+			revalidating = true
+		}
+	}
+
+	var lifetime time.Duration
+	rec := &recorder{w: w, header: make(http.Header), limit: c.maxEntryBytes}
+	rec.decide = func(status int, header http.Header) (bool, bool) {
+		if revalidating && status == http.StatusNotModified {
+			return false, false
+		}
+
+		var storable bool
+		lifetime, storable = p.lifetime(status, header, personal, time.Now())
+		if !storable {
+			return true, false
+		}
+		// A client whose copy is still current gets a 304 once the
+		// response is known to match it
+		return !notModified(req, header), true
+	}
+
+	next.ServeHTTP(rec, out)
+	if rec.status == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+	now := time.Now()
+
+	if revalidating && rec.status == http.StatusNotModified {
+		header := cached.header.Clone()
+		for name, values := range rec.header {
+			if name != "Content-Length" {
+				header[name] = values
+			}
+		}
+
+		lifetime, storable := p.lifetime(cached.status, header, personal, now)
+		refreshed := newEntry(cached.key, key, cached.status, header, cached.body, lifetime, now)
+		if storable {
+			vary, _ := parseVary(header)
+			c.put(refreshed, vary)
+		}
+		respond(w, req, refreshed, resultRevalidated, now)
+		return resultRevalidated
+	}
+
+	vary, _ := parseVary(rec.header)
+	e := newEntry(variantKey(key, vary, req), key, rec.status, rec.header, rec.body.Bytes(), lifetime, now)
+	if rec.store {
+		c.put(e, vary)
+	}
+	if !rec.forward {
+		respond(w, req, e, resultMiss, now)
+	}
+	return resultMiss
+}
+
+// newEntry creates an entry for a response stored at now
+func newEntry(key, resourceKey string, status int, header http.Header, body []byte, lifetime time.Duration, now time.Time) *entry {
+	e := &entry{
+		key:      key,
+		resource: resourceKey,
+		status:   status,
+		header:   header,
+		body:     body,
+		storedAt: now,
+		age:      parseAge(header),
+	}
+	e.expires = now.Add(lifetime - e.age)
+	return e
+}
+
+// respond writes a stored response, or 304 if the client's copy is current
+func respond(w http.ResponseWriter, req *http.Request, e *entry, result string, now time.Time) {
+	header := w.Header()
+	for name, values := range e.header {
+		header[name] = append([]string(nil), values...)
+	}
+	header.Set("Age", strconv.FormatInt(int64(e.currentAge(now)/time.Second), 10))
+	header.Set(cacheHeader, result)
+
+	if notModified(req, e.header) {
+		header.Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(e.status)
+	w.Write(e.body)
+}
+
+// recorder captures a backend response for the cache. Once the status is
+// known, decide chooses whether the response is passed on to the client
+// and whether its body is kept for storing.
+type recorder struct {
+	w      http.ResponseWriter
+	header http.Header
+	decide func(status int, header http.Header) (forward, store bool)
+	limit  int64
+
+	status  int
+	forward bool
+	store   bool
+	body    bytes.Buffer
+}
+
+// Header implements http.ResponseWriter
+func (rec *recorder) Header() http.Header {
+	return rec.header
+}
+
+// WriteHeader implements http.ResponseWriter
+func (rec *recorder) WriteHeader(status int) {
+	if rec.status != 0 {
+		return
+	}
+	if status >= 100 && status < 200 {
+		// Informational responses go straight to the client
+		copyHeader(rec.w.Header(), rec.header)
+		rec.w.WriteHeader(status)
+		return
+	}
+
+	rec.status = status
+	rec.forward, rec.store = rec.decide(status, rec.header)
+	if rec.forward {
+		copyHeader(rec.w.Header(), rec.header)
+		rec.w.Header().Set(cacheHeader, resultMiss)
+		rec.w.WriteHeader(status)
+	}
+}
+
+// Write implements http.ResponseWriter
+func (rec *recorder) Write(p []byte) (int, error) {
+	if rec.status == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+
+	if rec.store {
+		if int64(rec.body.Len()+len(p)) > rec.limit {
+			// Too large to cache; keep streaming without buffering
+			rec.store = false
+			rec.body = bytes.Buffer{}
+		} else {
+			rec.body.Write(p)
+		}
+	}
+
+	if !rec.forward {
+		return len(p), nil
+	}
+	return rec.w.Write(p)
+}
+
+// Flush sends buffered data to the client when the response is forwarded
+func (rec *recorder) Flush() {
+	if rec.forward {
+		http.NewResponseController(rec.w).Flush()
+	}
+}
+
+// copyHeader copies all values of src into dst
+func copyHeader(dst, src http.Header) {
+	for name, values := range src {
+		dst[name] = append([]string(nil), values...)
+	}
+}
@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	cacheRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_cache_requests_total",
+			Help: "Total number of requests to cached routes by result (HIT, MISS, REVALIDATED, BYPASS)",
+		},
+		[]string{"route", "result"},
+	)
+
+	cacheEvictionsTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "gateway_cache_evictions_total",
+			Help: "Total number of responses evicted from the cache to make room",
+		},
+	)
+
+	cacheEntries = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "gateway_cache_entries",
+			Help: "Number of responses in the cache",
+		},
+	)
+
+	cacheBytes = promauto.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "gateway_cache_size_bytes",
+			Help: "Approximate size of the responses in the cache",
+		},
+	)
+)
@@ -0,0 +1,223 @@
+package cache
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-inventory-system/gateway/upstream"
+	"go-inventory-system/shared"
+)
+
+// cacheableStatus lists the response statuses that may be stored
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusGone:                 true,
+}
+
+// policy is a route's cache configuration
+type policy struct {
+	route   string
+	ttl     time.Duration
+	maxTTL  time.Duration
+	perUser bool
+	// keyHost includes the request host in resource keys, for routes that
+	// match on host
+	keyHost bool
+}
+
+// newPolicy creates the cache policy of a route
+func newPolicy(route shared.Route) policy {
+	return policy{
+		route:   route.ID(),
+		ttl:     route.Cache.TTL,
+		maxTTL:  route.Cache.MaxTTL,
+		perUser: route.Cache.PerUser,
+		keyHost: route.Match.Host != "",
+	}
+}
+
+// resourceKey identifies the resource requested by req, as served by the
+// variant of a split route the request was assigned to. user is empty for
+// anonymous requests.
+func (p policy) resourceKey(req *http.Request, user string) string {
+	key := p.route + " "
+	if p.keyHost {
+		key += strings.ToLower(req.Host)
+	}
+	key += req.URL.RequestURI()
+	if variant := upstream.Variant(req); variant != "" {
+		key += " variant=" + variant
+	}
+	if user != "" {
+		key += " user=" + user
+	}
+	return key
+}
+
+// writtenPaths returns the keys of the path written by req and of the
+// collection containing it, without query, variant or user
+func (p policy) writtenPaths(req *http.Request) []string {
+	base := p.route + " "
+	if p.keyHost {
+		base += strings.ToLower(req.Host)
+	}
+
+	path := strings.TrimSuffix(req.URL.EscapedPath(), "/")
+	keys := []string{base + path}
+	if i := strings.LastIndex(path, "/"); i > 0 {
+		keys = append(keys, base+path[:i])
+	}
+	return keys
+}
+
+// lifetime returns how long a response may be served without revalidation,
+// and whether it may be stored at all. A stored response with zero lifetime
+// is revalidated on every use.
+func (p policy) lifetime(status int, header http.Header, personal bool, now time.Time) (time.Duration, bool) {
+	if !cacheableStatus[status] || header.Get("Set-Cookie") != "" {
+		return 0, false
+	}
+	if _, vary := parseVary(header); vary {
+		return 0, false
+	}
+
+	cc := parseCacheControl(header.Values("Cache-Control"))
+	if cc.has("no-store") || (cc.has("private") && !personal) {
+		return 0, false
+	}
+
+	lifetime, explicit := cc.seconds("s-maxage")
+	if !explicit {
+		lifetime, explicit = cc.seconds("max-age")
+	}
+	if !explicit && header.Get("Expires") != "" {
+		explicit = true
+		if expires, err := http.ParseTime(header.Get("Expires")); err == nil {
+			if date, err := http.ParseTime(header.Get("Date")); err == nil {
+				now = date
+			}
+			lifetime = expires.Sub(now)
+		}
+	}
+	if !explicit {
+		lifetime = p.ttl
+	}
+	if cc.has("no-cache") || lifetime < 0 {
+		lifetime = 0
+	}
+	if p.maxTTL > 0 && lifetime > p.maxTTL {
+		lifetime = p.maxTTL
+	}
+
+	// Without a lifetime a response is only worth storing if it can be revalidated
+	if lifetime == 0 && header.Get("ETag") == "" && header.Get("Last-Modified") == "" {
+		return 0, false
+	}
+	return lifetime, true
+}
+
+// cacheControl holds the directives of Cache-Control headers, keyed by
+// lowercase name
+type cacheControl map[string]string
+
+// parseCacheControl parses Cache-Control header values
+func parseCacheControl(values []string) cacheControl {
+	cc := make(cacheControl)
+	for _, value := range values {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name == "" {
+				continue
+			}
+			cc[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+	return cc
+}
+
+// has reports whether a directive is present
+func (cc cacheControl) has(name string) bool {
+	_, ok := cc[name]
+	return ok
+}
+
+// seconds returns the value of a delta-seconds directive such as max-age
+func (cc cacheControl) seconds(name string) (time.Duration, bool) {
+	arg, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || seconds < 0 {
+		// Invalid values make the response stale
+		return 0, true
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// parseVary returns the request headers a response varies on, in canonical
+// form and sorted. The second result is true for "Vary: *", which makes a
+// response uncacheable.
+func parseVary(header http.Header) ([]string, bool) {
+	var names []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return nil, true
+			}
+			if name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, false
+}
+
+// parseAge returns the Age header of a response
+func parseAge(header http.Header) time.Duration {
+	seconds, err := strconv.ParseInt(header.Get("Age"), 10, 64)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// notModified evaluates a request's conditional headers against a response
+// the client may already have
+func notModified(req *http.Request, header http.Header) bool {
+	if match := req.Header.Get("If-None-Match"); match != "" {
+		etag := header.Get("ETag")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || weakTag(candidate) == weakTag(etag) {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(header.Get("Last-Modified"))
+	return err == nil && !modified.After(since)
+}
+
+// weakTag strips the weak indicator from an entity tag, for weak comparison
+func weakTag(etag string) string {
+	return strings.TrimPrefix(etag, "W/")
+}
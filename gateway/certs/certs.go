@@ -0,0 +1,135 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go-inventory-system/gateway/config"
+)
+
+// Pair names a certificate file and the file holding its private key
+type Pair struct {
+	CertFile string
+	KeyFile  string
+}
+
+// Store holds the gateway's TLS certificates and picks one for each
+// connection by the server name the client asks for. Certificates can be
+// reloaded from their files while the gateway serves connections.
+type Store struct {
+	pairs   []Pair
+	current atomic.Pointer[certSet]
+}
+
+// certSet is an immutable set of loaded certificates
+type certSet struct {
+	// byName indexes certificates by the DNS names they are valid for,
+	// including wildcard names such as "*.example.com"
+	byName map[string]*tls.Certificate
+	// fallback is served to clients that send no known server name
+	fallback *tls.Certificate
+}
+
+// ParsePairs parses "cert.pem:key.pem" entries
+func ParsePairs(entries []string) ([]Pair, error) {
+	pairs := make([]Pair, 0, len(entries))
+	for _, entry := range entries {
+		certFile, keyFile, ok := strings.Cut(entry, ":")
+		if !ok || certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("invalid certificate %q, expected cert-file:key-file", entry)
+		}
+		pairs = append(pairs, Pair{CertFile: certFile, KeyFile: keyFile})
+	}
+	return pairs, nil
+}
+
+// NewStore loads the certificates of pairs. The first certificate is served
+// when the client's server name matches none of them.
+func NewStore(pairs []Pair) (*Store, error) {
+	if len(pairs) == 0 {
+		return nil, errors.New("no certificates configured")
+	}
+
+	store := &Store{pairs: pairs}
+	if err := store.Reload(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Reload loads all certificates from their files and swaps them in. On
+// error the current certificates stay in use.
+func (s *Store) Reload() error {
+	set := &certSet{byName: make(map[string]*tls.Certificate)}
+	for _, pair := range s.pairs {
+		cert, err := tls.LoadX509KeyPair(pair.CertFile, pair.KeyFile)
+		if err != nil {
+			return fmt.Errorf("load certificate %s: %w", pair.CertFile, err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return fmt.Errorf("parse certificate %s: %w", pair.CertFile, err)
+		}
+		cert.Leaf = leaf
+
+		if set.fallback == nil {
+			set.fallback = &cert
+		}
+		names := leaf.DNSNames
+		if len(names) == 0 && leaf.Subject.CommonName != "" {
+			names = []string{leaf.Subject.CommonName}
+		}
+		for _, name := range names {
+			name = strings.ToLower(name)
+			// Earlier certificates win when names overlap
+			if _, ok := set.byName[name]; !ok {
+				set.byName[name] = &cert
+			}
+		}
+	}
+
+	s.current.Store(set)
+	return nil
+}
+
+// GetCertificate selects the certificate for a TLS handshake. It is meant
+// for tls.Config.GetCertificate.
+func (s *Store) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	set := s.current.Load()
+
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if cert, ok := set.byName[name]; ok {
+		return cert, nil
+	}
+	if _, parent, ok := strings.Cut(name, "."); ok {
+		if cert, ok := set.byName["*."+parent]; ok {
+			return cert, nil
+		}
+	}
+	return set.fallback, nil
+}
+
+// Watch reloads the certificates whenever one of their files changes, until
+// ctx is cancelled. A certificate and its key may be replaced one after the
+// other; the reload fails until both match and succeeds once they do.
+func (s *Store) Watch(ctx context.Context, interval time.Duration) {
+	reload := func() {
+		if err := s.Reload(); err != nil {
+			log.Printf("Failed to reload TLS certificates, keeping current ones: %v", err)
+			return
+		}
+		log.Printf("Reloaded %d TLS certificates", len(s.pairs))
+	}
+
+	for _, pair := range s.pairs {
+		go config.WatchFile(ctx, pair.CertFile, interval, reload)
+		go config.WatchFile(ctx, pair.KeyFile, interval, reload)
+	}
+}
@@ -1,7 +1,16 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"go-inventory-system/shared"
 
@@ -10,18 +19,95 @@ import (
 
 // GatewayConfig holds gateway-specific configuration
 type GatewayConfig struct {
-	Port   string         `yaml:"port"`
-	Routes []shared.Route `yaml:"routes"`
+	Port               string         `yaml:"port"`
+	Routes             []shared.Route `yaml:"routes"`
+	RoutesFile         string         `yaml:"-"`
+	RoutesPollInterval time.Duration  `yaml:"-"`
+	RetryBudgetRatio   float64        `yaml:"-"`
+	RetryMinPerSecond  int            `yaml:"-"`
+	CacheMaxBytes      int64          `yaml:"-"`
+	CacheMaxEntryBytes int64          `yaml:"-"`
+	CompressionMinSize int            `yaml:"-"`
+	MaxHeaderBytes     int            `yaml:"-"`
+	TLSCerts           []string       `yaml:"-"`
+	TLSMinVersion      string         `yaml:"-"`
+	TLSCipherSuites    []string       `yaml:"-"`
+	TLSReloadInterval  time.Duration  `yaml:"-"`
+	HTTPRedirectAddr   string         `yaml:"-"`
+	CompressionTypes   []string       `yaml:"-"`
+	AdminAddr          string         `yaml:"-"`
+	AdminUsername      string         `yaml:"-"`
+	AdminPassword      string         `yaml:"-"`
+}
+
+// reservedPaths are served by the gateway itself and cannot be routed
+var reservedPaths = map[string]bool{
+	"/health":  true,
+	"/metrics": true,
+}
+
+// defaultCompressionTypes are the media types the gateway compresses by default
+var defaultCompressionTypes = []string{
+	"application/json",
+	"application/problem+json",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+	"text/css",
+	"text/csv",
+	"text/html",
+	"text/plain",
+}
+
+// maxRetryAttempts bounds a route's retry max_attempts
+const maxRetryAttempts = 10
+
+// paramSegment matches a {name} path template segment
+var paramSegment = regexp.MustCompile(`^\{[A-Za-z_][A-Za-z0-9_]*\}$`)
+
+// variantName matches valid traffic split variant names, which are also used in cookies
+var variantName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// originPattern matches allowed CORS origins: a scheme and host with an
+// optional port, where the host may start with a "*." wildcard
+var originPattern = regexp.MustCompile(`^[a-z][a-z0-9+.-]*://(\*\.)?[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)*(:[0-9]+)?$`)
+
+// validMethods are the HTTP methods a route may allow
+var validMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
 }
 
 // LoadConfig loads gateway configuration
 func LoadConfig() *GatewayConfig {
 	return &GatewayConfig{
-		Port: getEnv("GATEWAY_PORT", "8000"),
+		Port:               getEnv("GATEWAY_PORT", "8000"),
+		RoutesFile:         getEnv("GATEWAY_ROUTES_FILE", "routes.yaml"),
+		RoutesPollInterval: getEnvAsDuration("GATEWAY_ROUTES_POLL_INTERVAL", 2*time.Second),
+		RetryBudgetRatio:   getEnvAsFloat("GATEWAY_RETRY_BUDGET_RATIO", 0.2),
+		RetryMinPerSecond:  getEnvAsInt("GATEWAY_RETRY_MIN_PER_SECOND", 10),
+		CacheMaxBytes:      int64(getEnvAsInt("GATEWAY_CACHE_MAX_BYTES", 64<<20)),
+		CacheMaxEntryBytes: int64(getEnvAsInt("GATEWAY_CACHE_MAX_ENTRY_BYTES", 1<<20)),
+		CompressionMinSize: getEnvAsInt("GATEWAY_COMPRESSION_MIN_SIZE", 1024),
+		CompressionTypes:   getEnvAsList("GATEWAY_COMPRESSION_TYPES", defaultCompressionTypes),
+		MaxHeaderBytes:     getEnvAsInt("GATEWAY_MAX_HEADER_BYTES", 64<<10),
+		TLSCerts:           getEnvAsList("GATEWAY_TLS_CERTS", nil),
+		TLSMinVersion:      getEnv("GATEWAY_TLS_MIN_VERSION", "1.2"),
+		TLSCipherSuites:    getEnvAsList("GATEWAY_TLS_CIPHER_SUITES", nil),
+		TLSReloadInterval:  getEnvAsDuration("GATEWAY_TLS_RELOAD_INTERVAL", 10*time.Second),
+		HTTPRedirectAddr:   os.Getenv("GATEWAY_HTTP_REDIRECT_ADDR"),
+		AdminAddr:          getEnv("GATEWAY_ADMIN_ADDR", "127.0.0.1:9000"),
+		AdminUsername:      getEnv("GATEWAY_ADMIN_USERNAME", "admin"),
+		AdminPassword:      os.Getenv("GATEWAY_ADMIN_PASSWORD"),
 	}
 }
 
-// LoadRoutes loads routes from YAML file
+// LoadRoutes loads routes from YAML file and validates them
 func LoadRoutes(filename string) ([]shared.Route, error) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
@@ -36,9 +122,293 @@ func LoadRoutes(filename string) ([]shared.Route, error) {
 		return nil, err
 	}
 
+	if err := ValidateRoutes(config.Routes); err != nil {
+		return nil, err
+	}
+
 	return config.Routes, nil
 }
 
+// ValidateRoutes checks that a set of routes can be served
+func ValidateRoutes(routes []shared.Route) error {
+	if len(routes) == 0 {
+		return errors.New("no routes defined")
+	}
+
+	seenMatches := make(map[string]bool)
+	seenIDs := make(map[string]bool)
+	for i, route := range routes {
+		if !strings.HasPrefix(route.Path, "/") || route.Path == "/" {
+			return fmt.Errorf("route %d: path %q must start with / and not be the root", i, route.Path)
+		}
+		path := strings.TrimSuffix(route.Path, "/")
+		if isReservedPath(path) {
+			return fmt.Errorf("route %d: path %q is reserved by the gateway", i, route.Path)
+		}
+		if err := validatePathTemplate(path); err != nil {
+			return fmt.Errorf("route %d: %w", i, err)
+		}
+
+		// Routes may share a path if they match different requests
+		match := fmt.Sprint(path, strings.ToLower(route.Match.Host), route.Match.Headers, route.Match.Query)
+		if seenMatches[match] {
+			return fmt.Errorf("route %d: duplicate path %q with the same match rules", i, route.Path)
+		}
+		seenMatches[match] = true
+		if seenIDs[route.ID()] {
+			return fmt.Errorf("route %d: duplicate route name %q; routes sharing a path must be named", i, route.ID())
+		}
+		seenIDs[route.ID()] = true
+
+		if host := route.Match.Host; host != "" && (strings.Contains(strings.TrimPrefix(host, "*."), "*") || strings.Contains(host, "/")) {
+			return fmt.Errorf("route %s: invalid match host %q", route.Path, host)
+		}
+
+		if len(route.Split.Variants) > 0 {
+			if route.Backend != "" || len(route.Upstreams) > 0 {
+				return fmt.Errorf("route %s: set either split variants or backend/upstreams, not both", route.Path)
+			}
+			if err := validateSplit(route.Split); err != nil {
+				return fmt.Errorf("route %s: %w", route.Path, err)
+			}
+		} else if err := validateUpstreams(route.Backend, route.Upstreams); err != nil {
+			return fmt.Errorf("route %s: %w", route.Path, err)
+		}
+
+		if route.HealthCheck.Path != "" && !strings.HasPrefix(route.HealthCheck.Path, "/") {
+			return fmt.Errorf("route %s: health check path %q must start with /", route.Path, route.HealthCheck.Path)
+		}
+		if route.HealthCheck.Interval < 0 || route.HealthCheck.MaxFailures < 0 {
+			return fmt.Errorf("route %s: health check interval and max_failures must not be negative", route.Path)
+		}
+
+		breaker := route.CircuitBreaker
+		if breaker.FailureRateThreshold < 0 || breaker.FailureRateThreshold > 100 ||
+			breaker.SlowCallRateThreshold < 0 || breaker.SlowCallRateThreshold > 100 {
+			return fmt.Errorf("route %s: circuit breaker rate thresholds must be between 0 and 100", route.Path)
+		}
+		for _, code := range breaker.FailureStatuses {
+			if code < 100 || code > 599 {
+				return fmt.Errorf("route %s: invalid circuit breaker failure status code %d", route.Path, code)
+			}
+		}
+
+		retry := route.Retry
+		if retry.MaxAttempts < 0 || retry.MaxAttempts > maxRetryAttempts {
+			return fmt.Errorf("route %s: retry max_attempts must be between 0 and %d", route.Path, maxRetryAttempts)
+		}
+		if retry.Backoff < 0 || retry.MaxBackoff < 0 || retry.MaxBodyBytes < 0 {
+			return fmt.Errorf("route %s: retry backoff and max_body_bytes must not be negative", route.Path)
+		}
+		for _, code := range retry.RetryOn {
+			if code < 100 || code > 599 {
+				return fmt.Errorf("route %s: invalid retry status code %d", route.Path, code)
+			}
+		}
+
+		timeouts := route.Timeouts
+		if timeouts.Connect < 0 || timeouts.Response < 0 || timeouts.Total < 0 || timeouts.Idle < 0 {
+			return fmt.Errorf("route %s: timeouts must not be negative", route.Path)
+		}
+
+		if route.Rewrite.Regex != "" {
+			if _, err := regexp.Compile(route.Rewrite.Regex); err != nil {
+				return fmt.Errorf("route %s: invalid rewrite regex: %w", route.Path, err)
+			}
+		}
+		if route.Rewrite.AddPrefix != "" && !strings.HasPrefix(route.Rewrite.AddPrefix, "/") {
+			return fmt.Errorf("route %s: rewrite add_prefix %q must start with /", route.Path, route.Rewrite.AddPrefix)
+		}
+
+		if mirror := route.Mirror; mirror.URL != "" {
+			if err := validateUpstreams(mirror.URL, nil); err != nil {
+				return fmt.Errorf("route %s: mirror: %w", route.Path, err)
+			}
+			if mirror.Percentage < 0 || mirror.Percentage > 100 {
+				return fmt.Errorf("route %s: mirror percentage must be between 0 and 100", route.Path)
+			}
+			if mirror.Timeout < 0 || mirror.MaxBodyBytes < 0 {
+				return fmt.Errorf("route %s: mirror timeout and max_body_bytes must not be negative", route.Path)
+			}
+		}
+
+		if route.Cache.TTL < 0 || route.Cache.MaxTTL < 0 {
+			return fmt.Errorf("route %s: cache ttl and max_ttl must not be negative", route.Path)
+		}
+
+		if err := validateLimits(route.Limits); err != nil {
+			return fmt.Errorf("route %s: limits: %w", route.Path, err)
+		}
+
+		if err := validateCORS(route.CORS); err != nil {
+			return fmt.Errorf("route %s: cors: %w", route.Path, err)
+		}
+
+		if err := validateUpstreamTLS(route); err != nil {
+			return fmt.Errorf("route %s: tls: %w", route.Path, err)
+		}
+
+		switch route.LoadBalancing.Strategy {
+		case "", shared.LoadBalanceRoundRobin, shared.LoadBalanceLeastConnections,
+			shared.LoadBalanceWeighted, shared.LoadBalanceConsistentHash:
+		default:
+			return fmt.Errorf("route %s: unknown load balancing strategy %q", route.Path, route.LoadBalancing.Strategy)
+		}
+
+		if len(route.Methods) == 0 {
+			return fmt.Errorf("route %s: no methods allowed", route.Path)
+		}
+		for _, method := range route.Methods {
+			if !validMethods[strings.ToUpper(method)] {
+				return fmt.Errorf("route %s: unknown method %q", route.Path, method)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateLimits checks a route's request limits
+func validateLimits(limits shared.RequestLimits) error {
+	if limits.MaxBodyBytes < 0 || limits.MaxHeaderBytes < 0 || limits.MaxJSONDepth < 0 || limits.MaxJSONElements < 0 {
+		return errors.New("limits must not be negative")
+	}
+	for _, contentType := range limits.ContentTypes {
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			return fmt.Errorf("invalid content type %q", contentType)
+		}
+	}
+	return nil
+}
+
+// validateCORS checks a route's CORS policy
+func validateCORS(cors shared.CORSPolicy) error {
+	for _, origin := range cors.AllowedOrigins {
+		if origin == "*" {
+			if cors.AllowCredentials {
+				return errors.New(`allowed origin "*" cannot be combined with allow_credentials; list the origins instead`)
+			}
+			continue
+		}
+		if !originPattern.MatchString(origin) {
+			return fmt.Errorf("invalid allowed origin %q", origin)
+		}
+	}
+	for _, method := range cors.AllowedMethods {
+		if !validMethods[strings.ToUpper(method)] {
+			return fmt.Errorf("unknown method %q", method)
+		}
+	}
+	if cors.MaxAge < 0 {
+		return errors.New("max_age must not be negative")
+	}
+	return nil
+}
+
+// validateUpstreamTLS checks a route's upstream TLS settings. They only
+// apply to https upstreams, so a route using them must not have plain ones.
+func validateUpstreamTLS(route shared.Route) error {
+	config := route.TLS
+	if config == (shared.UpstreamTLS{}) {
+		return nil
+	}
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return errors.New("cert_file and key_file must be set together")
+	}
+
+	upstreams := route.AllUpstreams()
+	for _, variant := range route.Split.Variants {
+		upstreams = append(upstreams, variant.AllUpstreams()...)
+	}
+	for _, upstream := range upstreams {
+		if !strings.HasPrefix(upstream.URL, "https://") {
+			return fmt.Errorf("upstream %q must use https", upstream.URL)
+		}
+	}
+	return nil
+}
+
+// validateUpstreams checks the backend or upstreams of a route or variant
+func validateUpstreams(backend string, upstreams []shared.Upstream) error {
+	if backend != "" && len(upstreams) > 0 {
+		return errors.New("set either backend or upstreams, not both")
+	}
+	if backend != "" {
+		upstreams = []shared.Upstream{{URL: backend}}
+	}
+	if len(upstreams) == 0 {
+		return errors.New("no backend or upstreams defined")
+	}
+
+	for _, upstream := range upstreams {
+		backendURL, err := url.Parse(upstream.URL)
+		if err != nil || backendURL.Host == "" || (backendURL.Scheme != "http" && backendURL.Scheme != "https") {
+			return fmt.Errorf("invalid backend URL %q", upstream.URL)
+		}
+		if upstream.Weight < 0 {
+			return fmt.Errorf("negative weight for upstream %q", upstream.URL)
+		}
+	}
+	return nil
+}
+
+// validateSplit checks the variants and stickiness of a traffic split
+func validateSplit(split shared.TrafficSplit) error {
+	switch split.Sticky {
+	case shared.StickyNone, shared.StickyUser, shared.StickyCookie:
+	default:
+		return fmt.Errorf("unknown split stickiness %q", split.Sticky)
+	}
+
+	names := make(map[string]bool)
+	totalWeight := 0
+	for _, variant := range split.Variants {
+		if !variantName.MatchString(variant.Name) {
+			return fmt.Errorf("variant name %q must be letters, digits, '.', '_' or '-'", variant.Name)
+		}
+		if names[variant.Name] {
+			return fmt.Errorf("duplicate variant %q", variant.Name)
+		}
+		names[variant.Name] = true
+
+		if variant.Weight < 0 {
+			return fmt.Errorf("variant %s: negative weight", variant.Name)
+		}
+		totalWeight += variant.Weight
+
+		if err := validateUpstreams(variant.Backend, variant.Upstreams); err != nil {
+			return fmt.Errorf("variant %s: %w", variant.Name, err)
+		}
+	}
+	if totalWeight == 0 {
+		return errors.New("split variants must have a positive total weight")
+	}
+	return nil
+}
+
+// validatePathTemplate checks that every {name} segment of a path is well formed
+func validatePathTemplate(path string) error {
+	for _, segment := range strings.Split(path, "/") {
+		if !strings.ContainsAny(segment, "{}") {
+			continue
+		}
+		if !paramSegment.MatchString(segment) {
+			return fmt.Errorf("path segment %q must be a literal or a {name} parameter", segment)
+		}
+	}
+	return nil
+}
+
+// isReservedPath checks if a path is, or is under, a path served by the gateway itself
+func isReservedPath(path string) bool {
+	for reserved := range reservedPaths {
+		if path == reserved || strings.HasPrefix(path, reserved+"/") {
+			return true
+		}
+	}
+	return false
+}
+
 // getEnv gets an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -46,3 +416,49 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+// getEnvAsList gets a comma-separated environment variable as a list or returns a default value
+func getEnvAsList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getEnvAsDuration gets an environment variable as a duration or returns a default value
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsInt gets an environment variable as an integer or returns a default value
+func getEnvAsInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if intValue, err := strconv.Atoi(value); err == nil {
+			return intValue
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsFloat gets an environment variable as a float or returns a default value
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
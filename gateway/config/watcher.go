@@ -0,0 +1,49 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"log"
+	"os"
+	"time"
+)
+
+// WatchFile polls a file and calls onChange whenever its content changes.
+// Polling on content rather than relying on filesystem events copes with
+// editors that replace files and with config mounted from volumes.
+func WatchFile(ctx context.Context, filename string, interval time.Duration, onChange func()) {
+	lastSum, _ := fileChecksum(filename)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sum, err := fileChecksum(filename)
+			if err != nil {
+				log.Printf("Failed to read %s: %v", filename, err)
+				continue
+			}
+			if bytes.Equal(sum, lastSum) {
+				continue
+			}
+
+			lastSum = sum
+			onChange()
+		}
+	}
+}
+
+// fileChecksum returns the SHA-256 checksum of a file's content
+func fileChecksum(filename string) ([]byte, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	return sum[:], nil
+}
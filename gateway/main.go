@@ -9,9 +9,16 @@ import (
 	"syscall"
 	"time"
 
+	"go-inventory-system/gateway/admin"
+	"go-inventory-system/gateway/cache"
+	"go-inventory-system/gateway/certs"
 	"go-inventory-system/gateway/config"
 	"go-inventory-system/gateway/middleware"
 	"go-inventory-system/gateway/router"
+	"go-inventory-system/gateway/upstream"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/time/rate"
 )
 
 func main() {
@@ -19,32 +26,145 @@ func main() {
 	cfg := config.LoadConfig()
 
 	// Initialize router with routes
-	routes, err := config.LoadRoutes("routes.yaml")
+	routes, err := config.LoadRoutes(cfg.RoutesFile)
 	if err != nil {
 		log.Fatalf("Failed to load routes: %v", err)
 	}
 
-	// Create router
-	router := router.NewRouter(routes)
+	// Create router; all routes share one retry budget and response cache
+	retryBudget := upstream.NewRetryBudget(cfg.RetryBudgetRatio, cfg.RetryMinPerSecond)
+	responseCache := cache.New(cfg.CacheMaxBytes, cfg.CacheMaxEntryBytes)
+	router, err := router.NewRouter(routes, retryBudget, responseCache)
+	if err != nil {
+		log.Fatalf("Failed to create router: %v", err)
+	}
 
 	// Setup middleware
-	router.Use(middleware.Logging)
-	router.Use(middleware.RateLimiting)
-	router.Use(middleware.Metrics)
+	router.Use(middleware.RequestIDMiddleware)
+	router.Use(middleware.LoggingMiddleware)
+	rateLimiter := middleware.NewRateLimiter(rate.Limit(10), 30) // 10 requests per second, burst of 30
+	router.Use(rateLimiter.Middleware)
+	router.Use(middleware.MetricsMiddleware)
+	router.Use(middleware.NewCompressor(cfg.CompressionMinSize, cfg.CompressionTypes).Middleware)
+
+	// Reload routes when the file changes or on SIGHUP, keeping the
+	// current routes if the new ones are invalid
+	reloadRoutes := func() error {
+		routes, err := config.LoadRoutes(cfg.RoutesFile)
+		if err == nil {
+			err = router.Reload(routes)
+		}
+		if err != nil {
+			log.Printf("Failed to reload routes, keeping current config: %v", err)
+			return err
+		}
+		log.Printf("Reloaded %d routes from %s", len(routes), cfg.RoutesFile)
+		return nil
+	}
+
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+	go config.WatchFile(watchCtx, cfg.RoutesFile, cfg.RoutesPollInterval, func() { reloadRoutes() })
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			reloadRoutes()
+		}
+	}()
+
+	// The admin API has its own listener and credentials, and is disabled
+	// unless a password is configured
+	var adminServer *http.Server
+	if cfg.AdminPassword != "" {
+		adminHandler := admin.NewHandler(router, rateLimiter, responseCache, reloadRoutes, admin.Credentials{
+			Username: cfg.AdminUsername,
+			Password: cfg.AdminPassword,
+		})
+		adminServer = &http.Server{
+			Addr:         cfg.AdminAddr,
+			Handler:      adminHandler,
+			ReadTimeout:  15 * time.Second,
+			WriteTimeout: 15 * time.Second,
+			IdleTimeout:  60 * time.Second,
+		}
+
+		go func() {
+			log.Printf("Gateway admin API starting on %s", cfg.AdminAddr)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Failed to start admin server: %v", err)
+			}
+		}()
+	} else {
+		log.Println("Gateway admin API disabled: GATEWAY_ADMIN_PASSWORD is not set")
+	}
+
+	// Metrics are served alongside the routed traffic
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/", router)
 
 	// Create server
 	server := &http.Server{
-		Addr:         ":" + cfg.Port,
-		Handler:      router,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		Addr:           ":" + cfg.Port,
+		Handler:        mux,
+		ReadTimeout:    15 * time.Second,
+		WriteTimeout:   15 * time.Second,
+		IdleTimeout:    60 * time.Second,
+		MaxHeaderBytes: cfg.MaxHeaderBytes,
+	}
+
+	// Terminate TLS when certificates are configured, reloading them when
+	// their files change
+	var redirectServer *http.Server
+	if len(cfg.TLSCerts) > 0 {
+		pairs, err := certs.ParsePairs(cfg.TLSCerts)
+		if err != nil {
+			log.Fatalf("Invalid GATEWAY_TLS_CERTS: %v", err)
+		}
+		certStore, err := certs.NewStore(pairs)
+		if err != nil {
+			log.Fatalf("Failed to load TLS certificates: %v", err)
+		}
+		server.TLSConfig, err = certs.NewTLSConfig(certStore, cfg.TLSMinVersion, cfg.TLSCipherSuites)
+		if err != nil {
+			log.Fatalf("Invalid TLS configuration: %v", err)
+		}
+		certStore.Watch(watchCtx, cfg.TLSReloadInterval)
+
+		// Optionally redirect plaintext HTTP to HTTPS
+		if cfg.HTTPRedirectAddr != "" {
+			redirectServer = &http.Server{
+				Addr:         cfg.HTTPRedirectAddr,
+				Handler:      certs.RedirectHandler(cfg.Port),
+				ReadTimeout:  15 * time.Second,
+				WriteTimeout: 15 * time.Second,
+				IdleTimeout:  60 * time.Second,
+			}
+
+			go func() {
+				log.Printf("Gateway HTTPS redirect starting on %s", cfg.HTTPRedirectAddr)
+				if err := redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					log.Fatalf("Failed to start redirect server: %v", err)
+				}
+			}()
+		}
+	} else if cfg.HTTPRedirectAddr != "" {
+		log.Println("Gateway HTTPS redirect disabled: GATEWAY_TLS_CERTS is not set")
 	}
 
 	// Start server in a goroutine
 	go func() {
-		log.Printf("Gateway starting on port %s", cfg.Port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if server.TLSConfig != nil {
+			log.Printf("Gateway starting on port %s with TLS", cfg.Port)
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			log.Printf("Gateway starting on port %s", cfg.Port)
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Failed to start server: %v", err)
 		}
 	}()
@@ -60,9 +180,16 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	if adminServer != nil {
+		adminServer.Shutdown(ctx)
+	}
+	if redirectServer != nil {
+		redirectServer.Shutdown(ctx)
+	}
 	if err := server.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 
+	router.Close()
 	log.Println("Gateway exited")
 }
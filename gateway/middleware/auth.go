@@ -20,14 +20,14 @@ func AuthMiddleware(next http.Handler) http.Handler {
 		// Extract token from header
 		token, err := shared.ExtractTokenFromHeader(r)
 		if err != nil {
-			shared.WriteErrorResponse(w, http.StatusUnauthorized, "Invalid or missing token")
+			shared.WriteError(w, r, shared.NewAPIError(http.StatusUnauthorized, shared.ErrCodeUnauthorized, "Invalid or missing token"))
 			return
 		}
 
 		// Validate token
 		claims, err := shared.ValidateJWT(token)
 		if err != nil {
-			shared.WriteErrorResponse(w, http.StatusUnauthorized, "Invalid token")
+			shared.WriteError(w, r, shared.NewAPIError(http.StatusUnauthorized, shared.ErrCodeInvalidToken, "Invalid token"))
 			return
 		}
 
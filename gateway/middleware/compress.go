@@ -0,0 +1,323 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Supported content encodings
+const (
+	encodingBrotli = "br"
+	encodingZstd   = "zstd"
+	encodingGzip   = "gzip"
+
+	// brotliLevel trades compression ratio for speed; the highest levels
+	// are too slow for dynamic responses
+	brotliLevel = 5
+)
+
+// supportedEncodings lists the encodings in order of preference, used when
+// a client accepts several equally
+var supportedEncodings = []string{encodingBrotli, encodingZstd, encodingGzip}
+
+// zstdOptions configures zstd encoders for many small concurrent responses
+var zstdOptions = []zstd.EOption{zstd.WithEncoderConcurrency(1), zstd.WithWindowSize(1 << 20)}
+
+// encoder is a compressing writer that can be reused
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// Compressor compresses responses with an encoding the client accepts
+type Compressor struct {
+	minSize int
+	types   []string
+	// encodings lists the supported encodings that have a pool, in order of preference
+	encodings []string
+	pools     map[string]*sync.Pool
+}
+
+// NewCompressor creates a compressor for responses of at least minSize bytes
+// whose media type is one of contentTypes. A type ending in "/*" matches all
+// subtypes. zstd is left out if its encoder cannot be created.
+func NewCompressor(minSize int, contentTypes []string) *Compressor {
+	pools := map[string]*sync.Pool{
+		encodingBrotli: {New: func() interface{} {
+			return brotli.NewWriterLevel(nil, brotliLevel)
+		}},
+		encodingGzip: {New: func() interface{} {
+			return gzip.NewWriter(nil)
+		}},
+	}
+
+	if enc, err := zstd.NewWriter(nil, zstdOptions...); err != nil {
+		log.Printf("zstd compression disabled: %v", err)
+	} else {
+		pool := &sync.Pool{New: func() interface{} {
+			enc, err := zstd.NewWriter(nil, zstdOptions...)
+			if err != nil {
+				return nil
+			}
+			return enc
+		}}
+		pool.Put(enc)
+		pools[encodingZstd] = pool
+	}
+
+	c := &Compressor{minSize: minSize, types: contentTypes, pools: pools}
+	for _, encoding := range supportedEncodings {
+		if _, ok := pools[encoding]; ok {
+			c.encodings = append(c.encodings, encoding)
+		}
+	}
+	return c
+}
+
+// Middleware compresses responses based on the request's Accept-Encoding
+func (c *Compressor) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), c.encodings)
+		if r.Method == http.MethodHead {
+			encoding = ""
+		}
+
+		// Responses that are not compressed still pass through the writer,
+		// which marks them as varying with Accept-Encoding
+		cw := &compressWriter{ResponseWriter: w, compressor: c, encoding: encoding}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressible reports whether a media type is configured for compression
+func (c *Compressor) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range c.types {
+		if prefix, ok := strings.CutSuffix(t, "*"); ok && strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+		if mediaType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateEncoding picks the encoding of encodings with the highest quality
+// in an Accept-Encoding header, or "" if there is none. encodings are in
+// order of preference.
+func negotiateEncoding(header string, encodings []string) string {
+	if header == "" {
+		return ""
+	}
+
+	accepted := make(map[string]float64)
+	wildcard := -1.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			q, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				q = 0
+			}
+			quality = q
+		}
+
+		if name == "*" {
+			wildcard = quality
+		} else {
+			accepted[name] = quality
+		}
+	}
+
+	best, bestQuality := "", 0.0
+	for _, encoding := range encodings {
+		quality, ok := accepted[encoding]
+		if !ok {
+			quality = wildcard
+		}
+		if quality > bestQuality {
+			best, bestQuality = encoding, quality
+		}
+	}
+	return best
+}
+
+// compressWriter compresses a response once it is known to qualify. An
+// empty encoding means the response is never compressed. Bodies
+// without a Content-Length are buffered until they reach the minimum size,
+// unless they are flushed first: streamed responses are compressed as they
+// go, with each flush sending what has been compressed so far.
+type compressWriter struct {
+	http.ResponseWriter
+	compressor *Compressor
+	encoding   string
+
+	status  int
+	decided bool
+	buf     []byte
+	enc     encoder
+}
+
+// WriteHeader holds the status until the response is known to qualify
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.status != 0 || cw.decided {
+		return
+	}
+	if code < http.StatusOK {
+		// Informational responses and protocol switches pass through
+		if code == http.StatusSwitchingProtocols {
+			cw.decided = true
+		}
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	cw.status = code
+	if !cw.eligible() {
+		cw.decide(false)
+		return
+	}
+	// Whether it ends up compressed or not, the response depends on Accept-Encoding
+	addVary(cw.Header(), "Accept-Encoding")
+	if cw.encoding == "" {
+		cw.decide(false)
+		return
+	}
+	if length, err := strconv.Atoi(cw.Header().Get("Content-Length")); err == nil {
+		cw.decide(length >= cw.compressor.minSize)
+	}
+}
+
+// Write compresses or buffers the body
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 && !cw.decided {
+		cw.WriteHeader(http.StatusOK)
+	}
+
+	if !cw.decided {
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) >= cw.compressor.minSize {
+			if err := cw.decide(true); err != nil {
+				return 0, err
+			}
+		}
+		return len(b), nil
+	}
+
+	if cw.enc != nil {
+		return cw.enc.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush sends everything written so far to the client
+func (cw *compressWriter) Flush() {
+	if cw.status != 0 && !cw.decided {
+		cw.decide(true)
+	}
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// eligible reports whether the response may be compressed, judging by its
+// status and headers
+func (cw *compressWriter) eligible() bool {
+	header := cw.Header()
+	switch {
+	case cw.status == http.StatusNoContent, cw.status == http.StatusNotModified,
+		cw.status == http.StatusPartialContent:
+		return false
+	case header.Get("Content-Encoding") != "" && header.Get("Content-Encoding") != "identity":
+		// Already compressed upstream
+		return false
+	case header.Get("Content-Range") != "":
+		return false
+	case strings.Contains(strings.ToLower(header.Get("Cache-Control")), "no-transform"):
+		return false
+	}
+	return cw.compressor.compressible(header.Get("Content-Type"))
+}
+
+// decide sends the response headers, compressed or not, followed by any
+// buffered body. A response is sent uncompressed if no encoder is available.
+func (cw *compressWriter) decide(compress bool) error {
+	cw.decided = true
+
+	header := cw.Header()
+	if pool, ok := cw.compressor.pools[cw.encoding]; compress && ok {
+		cw.enc, _ = pool.Get().(encoder)
+	}
+	if cw.enc != nil {
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", cw.encoding)
+		// The compressed body is a different representation
+		if etag := header.Get("ETag"); strings.HasPrefix(etag, `"`) {
+			header.Set("ETag", "W/"+etag)
+		}
+		cw.enc.Reset(cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	buf := cw.buf
+	cw.buf = nil
+	if cw.enc != nil {
+		_, err := cw.enc.Write(buf)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+// close finishes the response, sending bodies too small to compress as they are
+func (cw *compressWriter) close() {
+	if cw.status != 0 && !cw.decided {
+		cw.decide(false)
+	}
+	if cw.enc != nil {
+		cw.enc.Close()
+		cw.enc.Reset(nil)
+		cw.compressor.pools[cw.encoding].Put(cw.enc)
+		cw.enc = nil
+	}
+}
+
+// addVary adds a request header to the Vary header unless it is already listed
+func addVary(header http.Header, name string) {
+	for _, value := range header.Values("Vary") {
+		for _, listed := range strings.Split(value, ",") {
+			listed = strings.TrimSpace(listed)
+			if listed == "*" || strings.EqualFold(listed, name) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", name)
+}
@@ -4,6 +4,8 @@ import (
 	"log"
 	"net/http"
 	"time"
+
+	"go-inventory-system/shared"
 )
 
 // LoggingMiddleware logs all requests and responses
@@ -25,12 +27,13 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 
 		// Log request details
 		log.Printf(
-			"%s %s %s %d %v",
+			"%s %s %s %d %v %s",
 			r.Method,
 			r.URL.Path,
 			r.RemoteAddr,
 			responseWriter.statusCode,
 			duration,
+			r.Header.Get(shared.RequestIDHeader),
 		)
 	})
 }
@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"sync"
 
+	"go-inventory-system/shared"
+
 	"golang.org/x/time/rate"
 )
 
@@ -38,16 +40,14 @@ func (rl *RateLimiter) getLimiter(clientID string) *rate.Limiter {
 	return limiter
 }
 
-// RateLimitingMiddleware applies rate limiting to requests
-func RateLimitingMiddleware(next http.Handler) http.Handler {
-	limiter := NewRateLimiter(rate.Limit(10), 30) // 10 requests per second, burst of 30
-
+// Middleware applies the rate limiter to requests
+func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		clientID := getClientID(r)
-		limiter := limiter.getLimiter(clientID)
+		limiter := rl.getLimiter(clientID)
 
 		if !limiter.Allow() {
-			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			shared.WriteError(w, r, shared.NewAPIError(http.StatusTooManyRequests, shared.ErrCodeRateLimited, "Rate limit exceeded"))
 			return
 		}
 
@@ -55,6 +55,34 @@ func RateLimitingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// RateLimiterStats is a snapshot of the rate limiter state
+type RateLimiterStats struct {
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	Burst             int     `json:"burst"`
+	Clients           int     `json:"clients"`
+	// Throttled lists the remaining tokens of clients that have used part of their burst
+	Throttled map[string]float64 `json:"throttled"`
+}
+
+// Stats returns a snapshot of the rate limiter state
+func (rl *RateLimiter) Stats() RateLimiterStats {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+
+	stats := RateLimiterStats{
+		RequestsPerSecond: float64(rl.rps),
+		Burst:             rl.burst,
+		Clients:           len(rl.limiters),
+		Throttled:         make(map[string]float64),
+	}
+	for clientID, limiter := range rl.limiters {
+		if tokens := limiter.Tokens(); tokens < float64(rl.burst) {
+			stats.Throttled[clientID] = tokens
+		}
+	}
+	return stats
+}
+
 // getClientID extracts client identifier from request
 func getClientID(r *http.Request) string {
 	// Use IP address as client identifier
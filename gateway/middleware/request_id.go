@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go-inventory-system/shared"
+)
+
+// maxRequestIDLength bounds the request IDs accepted from clients
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware ensures every request carries an X-Request-ID header.
+// The ID is forwarded to backend services and echoed back to the client.
+// Client-supplied IDs that are too long or contain characters other than
+// letters, digits, '-', '_', '.' and ':' are replaced.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(shared.RequestIDHeader)
+		if !isValidRequestID(requestID) {
+			requestID = ""
+			if id, err := shared.GenerateRandomString(16); err == nil {
+				requestID = id
+			}
+		}
+
+		// Set rather than keep the header so only one ID is forwarded
+		if requestID != "" {
+			r.Header.Set(shared.RequestIDHeader, requestID)
+			w.Header().Set(shared.RequestIDHeader, requestID)
+		} else {
+			r.Header.Del(shared.RequestIDHeader)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isValidRequestID checks a request ID is safe to log and forward
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,246 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"go-inventory-system/gateway/upstream"
+	"go-inventory-system/shared"
+)
+
+// maxCoalescedBodyBytes is the largest response shared between coalesced
+// requests. Requests waiting on a larger response are sent on their own.
+const maxCoalescedBodyBytes = 1 << 20
+
+// errCoalescedBodyTooLarge aborts a shared call whose response is too large
+var errCoalescedBodyTooLarge = errors.New("coalesced response too large")
+
+// coalesceKeyHeaders are request headers that may change the response, so
+// requests differing in them are not coalesced
+var coalesceKeyHeaders = []string{"Accept", "Accept-Encoding", "Accept-Language", "Cookie"}
+
+// coalescer sends concurrent identical GET requests of a route to the
+// backend once and gives every request a copy of the response
+type coalescer struct {
+	route      string
+	keyHeaders []string
+
+	mu    sync.Mutex
+	calls map[string]*sharedCall
+}
+
+// sharedCall is a backend request shared by identical client requests
+type sharedCall struct {
+	key    string
+	done   chan struct{}
+	cancel context.CancelFunc
+	// waiters counts the requests still interested in the response; the
+	// call is cancelled when all of them have gone. Guarded by coalescer.mu.
+	waiters int
+
+	// The response, set before done is closed. ok is false if the call
+	// failed or the response was too large to share.
+	ok     bool
+	status int
+	header http.Header
+	body   []byte
+}
+
+// newCoalescer creates a coalescer for a route
+func newCoalescer(route shared.Route) *coalescer {
+	c := &coalescer{
+		route:      route.ID(),
+		keyHeaders: coalesceKeyHeaders,
+		calls:      make(map[string]*sharedCall),
+	}
+	if len(route.Split.Variants) > 0 {
+		override := route.Split.OverrideHeader
+		if override == "" {
+			override = defaultOverrideHeader
+		}
+		c.keyHeaders = append(append([]string(nil), coalesceKeyHeaders...), override)
+	}
+	return c
+}
+
+// wrap returns a handler coalescing identical GET requests to next
+func (c *coalescer) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		key, ok := c.key(req)
+		if !ok {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		call, leader := c.join(key, req, next)
+		select {
+		case <-call.done:
+		case <-req.Context().Done():
+			c.leave(call)
+			return
+		}
+
+		if !call.ok {
+			coalescedRequestsTotal.WithLabelValues(c.route, "fallback").Inc()
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		role := "follower"
+		if leader {
+			role = "leader"
+		}
+		coalescedRequestsTotal.WithLabelValues(c.route, role).Inc()
+
+		header := w.Header()
+		for name, values := range call.header {
+			header[name] = append([]string(nil), values...)
+		}
+		w.WriteHeader(call.status)
+		w.Write(call.body)
+	})
+}
+
+// key identifies requests that can share a response: the same path, query,
+// negotiation headers, authenticated user and variant. Authenticated requests
+// without a valid token are not coalesced.
+func (c *coalescer) key(req *http.Request) (string, bool) {
+	if req.Method != http.MethodGet || upstream.IsStream(req) {
+		return "", false
+	}
+
+	subject := ""
+	if req.Header.Get("Authorization") != "" {
+		if subject = upstream.UserID(req); subject == "" {
+			return "", false
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.ToLower(req.Host))
+	b.WriteString(req.URL.RequestURI())
+	b.WriteString("\nuser:")
+	b.WriteString(subject)
+	b.WriteString("\nvariant:")
+	b.WriteString(upstream.Variant(req))
+	for _, name := range c.keyHeaders {
+		b.WriteByte('\n')
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(strings.Join(req.Header.Values(name), ","))
+	}
+	return b.String(), true
+}
+
+// join adds a request to the call for key, starting the call if there is
+// none in flight. It reports whether the request started the call.
+func (c *coalescer) join(key string, req *http.Request, next http.Handler) (*sharedCall, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if call, ok := c.calls[key]; ok {
+		call.waiters++
+		return call, false
+	}
+
+	// The call outlives the request that started it as long as other
+	// requests wait on it, but keeps its deadline
+	var ctx context.Context
+	var cancel context.CancelFunc
+	detached := context.WithoutCancel(req.Context())
+	if deadline, ok := req.Context().Deadline(); ok {
+		ctx, cancel = context.WithDeadline(detached, deadline)
+	} else {
+		ctx, cancel = context.WithCancel(detached)
+	}
+
+	call := &sharedCall{key: key, done: make(chan struct{}), cancel: cancel, waiters: 1}
+	c.calls[key] = call
+	go c.run(call, next, req.WithContext(ctx))
+	return call, true
+}
+
+// leave removes a request that stopped waiting, cancelling the call once
+// nobody waits on it. Later requests start a new call.
+func (c *coalescer) leave(call *sharedCall) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	call.waiters--
+	if call.waiters == 0 {
+		call.cancel()
+		c.forget(call)
+	}
+}
+
+// forget removes a call from the calls in flight. c.mu must be held.
+func (c *coalescer) forget(call *sharedCall) {
+	if c.calls[call.key] == call {
+		delete(c.calls, call.key)
+	}
+}
+
+// run sends the shared request and records its response
+func (c *coalescer) run(call *sharedCall, next http.Handler, req *http.Request) {
+	rec := &bufferedResponse{header: make(http.Header)}
+	completed := false
+	defer func() {
+		// The proxy aborts with a panic when the response body fails midway
+		if err := recover(); err != nil && err != http.ErrAbortHandler {
+			log.Printf("Coalesced request for %s %s panicked: %v", req.Method, req.URL.Path, err)
+		}
+
+		c.mu.Lock()
+		c.forget(call)
+		c.mu.Unlock()
+
+		call.ok = completed && !rec.tooLarge
+		call.status, call.header, call.body = rec.status, rec.header, rec.body.Bytes()
+		call.cancel()
+		close(call.done)
+	}()
+
+	next.ServeHTTP(rec, req)
+	if rec.status == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+	completed = true
+}
+
+// bufferedResponse holds a complete response in memory
+type bufferedResponse struct {
+	header   http.Header
+	status   int
+	body     bytes.Buffer
+	tooLarge bool
+}
+
+// Header implements http.ResponseWriter
+func (rec *bufferedResponse) Header() http.Header {
+	return rec.header
+}
+
+// WriteHeader implements http.ResponseWriter. Informational responses
+// are not shared.
+func (rec *bufferedResponse) WriteHeader(status int) {
+	if rec.status == 0 && status >= 200 {
+		rec.status = status
+	}
+}
+
+// Write implements http.ResponseWriter
+func (rec *bufferedResponse) Write(p []byte) (int, error) {
+	if rec.status == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if rec.body.Len()+len(p) > maxCoalescedBodyBytes {
+		rec.tooLarge = true
+		return 0, errCoalescedBodyTooLarge
+	}
+	return rec.body.Write(p)
+}
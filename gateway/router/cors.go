@@ -0,0 +1,239 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-inventory-system/shared"
+)
+
+// defaultCORSHeaders are the request headers allowed when a policy lists none
+var defaultCORSHeaders = []string{"Content-Type", "Authorization"}
+
+// safelistedHeaders are request headers browsers may always send cross-origin
+var safelistedHeaders = map[string]bool{
+	"accept":           true,
+	"accept-language":  true,
+	"content-language": true,
+}
+
+// corsPolicy applies a route's CORS configuration
+type corsPolicy struct {
+	anyOrigin   bool
+	origins     map[string]bool
+	wildcards   []originWildcard
+	methods     map[string]bool
+	anyHeader   bool
+	headers     map[string]bool
+	allowMethod string
+	allowHeader string
+	expose      string
+	credentials bool
+	maxAge      string
+}
+
+// originWildcard matches origins by scheme and host suffix, for patterns
+// such as "https://*.example.com"
+type originWildcard struct {
+	prefix string
+	suffix string
+}
+
+// newCORSPolicy creates the CORS policy of a route, or returns nil if the
+// route allows no origins
+func newCORSPolicy(route shared.Route) *corsPolicy {
+	config := route.CORS
+	if len(config.AllowedOrigins) == 0 {
+		return nil
+	}
+
+	p := &corsPolicy{
+		origins:     make(map[string]bool),
+		methods:     make(map[string]bool),
+		headers:     make(map[string]bool),
+		credentials: config.AllowCredentials,
+		expose:      strings.Join(config.ExposedHeaders, ", "),
+	}
+	for _, origin := range config.AllowedOrigins {
+		switch {
+		case origin == "*":
+			p.anyOrigin = true
+		case strings.Contains(origin, "*"):
+			prefix, suffix, _ := strings.Cut(strings.ToLower(origin), "*")
+			p.wildcards = append(p.wildcards, originWildcard{prefix: prefix, suffix: suffix})
+		default:
+			p.origins[strings.ToLower(origin)] = true
+		}
+	}
+
+	methods := config.AllowedMethods
+	if len(methods) == 0 {
+		methods = route.Methods
+	}
+	allowed := make([]string, len(methods))
+	for i, method := range methods {
+		allowed[i] = strings.ToUpper(method)
+		p.methods[allowed[i]] = true
+	}
+	p.allowMethod = strings.Join(allowed, ", ")
+
+	headers := config.AllowedHeaders
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+	for _, header := range headers {
+		if header == "*" {
+			p.anyHeader = true
+		}
+		p.headers[strings.ToLower(header)] = true
+	}
+	p.allowHeader = strings.Join(headers, ", ")
+
+	if config.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(int(config.MaxAge.Seconds()))
+	}
+	return p
+}
+
+// allowOrigin reports whether requests from origin are allowed
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if p.origins[origin] {
+		return true
+	}
+	for _, w := range p.wildcards {
+		if len(origin) > len(w.prefix)+len(w.suffix) && strings.HasPrefix(origin, w.prefix) && strings.HasSuffix(origin, w.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPreflight reports whether req is a CORS preflight request
+func isPreflight(req *http.Request) bool {
+	return req.Method == http.MethodOptions && req.Header.Get("Origin") != "" &&
+		req.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// preflight answers a preflight request without involving the backend
+func (p *corsPolicy) preflight(w http.ResponseWriter, req *http.Request) {
+	header := w.Header()
+	header.Add("Vary", "Origin")
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+
+	origin := req.Header.Get("Origin")
+	if !p.allowOrigin(origin) {
+		shared.WriteError(w, req, shared.NewAPIError(http.StatusForbidden, shared.ErrCodeForbidden, "Origin not allowed"))
+		return
+	}
+	if method := req.Header.Get("Access-Control-Request-Method"); !p.methods[strings.ToUpper(method)] {
+		shared.WriteError(w, req, shared.NewAPIError(http.StatusForbidden, shared.ErrCodeForbidden, "Method not allowed for cross-origin requests"))
+		return
+	}
+
+	requested := parseHeaderList(req.Header.Get("Access-Control-Request-Headers"))
+	for _, name := range requested {
+		if !p.anyHeader && !p.headers[name] && !safelistedHeaders[name] {
+			shared.WriteError(w, req, shared.NewAPIError(http.StatusForbidden, shared.ErrCodeForbidden, "Header "+name+" not allowed for cross-origin requests"))
+			return
+		}
+	}
+
+	p.setOrigin(header, origin)
+	header.Set("Access-Control-Allow-Methods", p.allowMethod)
+	if p.anyHeader {
+		// Credentialed requests cannot use "*", so the requested headers are echoed
+		if len(requested) > 0 {
+			header.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+		}
+	} else {
+		header.Set("Access-Control-Allow-Headers", p.allowHeader)
+	}
+	if p.maxAge != "" {
+		header.Set("Access-Control-Max-Age", p.maxAge)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setOrigin sets the origin and credentials headers of an allowed request
+func (p *corsPolicy) setOrigin(header http.Header, origin string) {
+	if p.anyOrigin && !p.credentials {
+		header.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		header.Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.credentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// wrap returns a writer that replaces the CORS headers of the response to
+// a cross-origin request with the policy's
+func (p *corsPolicy) wrap(w http.ResponseWriter, req *http.Request) http.ResponseWriter {
+	return &corsWriter{ResponseWriter: w, policy: p, origin: req.Header.Get("Origin")}
+}
+
+// corsWriter sets CORS headers when the response headers are written
+type corsWriter struct {
+	http.ResponseWriter
+	policy      *corsPolicy
+	origin      string
+	wroteHeader bool
+}
+
+// WriteHeader implements http.ResponseWriter
+func (cw *corsWriter) WriteHeader(code int) {
+	if !cw.wroteHeader && code >= http.StatusOK {
+		cw.wroteHeader = true
+		cw.setHeaders()
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+// Write implements http.ResponseWriter
+func (cw *corsWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (cw *corsWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// setHeaders removes CORS headers set by the backend and adds the policy's
+func (cw *corsWriter) setHeaders() {
+	header := cw.Header()
+	for name := range header {
+		if strings.HasPrefix(name, "Access-Control-") {
+			delete(header, name)
+		}
+	}
+
+	header.Add("Vary", "Origin")
+	if !cw.policy.allowOrigin(cw.origin) {
+		return
+	}
+	cw.policy.setOrigin(header, cw.origin)
+	if cw.policy.expose != "" {
+		header.Set("Access-Control-Expose-Headers", cw.policy.expose)
+	}
+}
+
+// parseHeaderList splits a comma-separated list of header names, in lowercase
+func parseHeaderList(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
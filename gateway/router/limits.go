@@ -0,0 +1,120 @@
+package router
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"go-inventory-system/shared"
+)
+
+// defaultMaxBodyBytes bounds request bodies of routes without their own limit
+const defaultMaxBodyBytes = 10 << 20
+
+// requestLimits enforces a route's request limits
+type requestLimits struct {
+	maxBodyBytes   int64
+	maxHeaderBytes int
+	contentTypes   map[string]bool
+	json           shared.JSONLimits
+}
+
+// newRequestLimits creates the request limits of a route
+func newRequestLimits(route shared.Route) *requestLimits {
+	config := route.Limits
+	l := &requestLimits{
+		maxBodyBytes:   config.MaxBodyBytes,
+		maxHeaderBytes: config.MaxHeaderBytes,
+		json:           shared.JSONLimits{MaxDepth: config.MaxJSONDepth, MaxElements: config.MaxJSONElements},
+	}
+	if l.maxBodyBytes == 0 {
+		l.maxBodyBytes = defaultMaxBodyBytes
+	}
+	if len(config.ContentTypes) > 0 {
+		l.contentTypes = make(map[string]bool)
+		for _, contentType := range config.ContentTypes {
+			mediaType, _, _ := mime.ParseMediaType(contentType)
+			l.contentTypes[mediaType] = true
+		}
+	}
+	return l
+}
+
+// apply checks a request against the limits and bounds its body. If the
+// request violates them it writes the error response and returns false.
+func (l *requestLimits) apply(w http.ResponseWriter, req *http.Request) bool {
+	if l.maxHeaderBytes > 0 && headerSize(req.Header) > l.maxHeaderBytes {
+		shared.WriteError(w, req, shared.NewAPIError(http.StatusRequestHeaderFieldsTooLarge, shared.ErrCodeHeadersTooLarge, "Request headers are too large"))
+		return false
+	}
+
+	if req.Body == nil || req.Body == http.NoBody {
+		return true
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if l.contentTypes != nil && !l.contentTypes[mediaType] {
+		shared.WriteError(w, req, shared.NewAPIError(http.StatusUnsupportedMediaType, shared.ErrCodeUnsupportedMedia, "Unsupported content type"))
+		return false
+	}
+
+	if req.ContentLength > l.maxBodyBytes {
+		writeBodyTooLarge(w, req)
+		return false
+	}
+	req.Body = http.MaxBytesReader(w, req.Body, l.maxBodyBytes)
+
+	if l.json != (shared.JSONLimits{}) && isJSON(mediaType) {
+		return l.checkJSON(w, req)
+	}
+	return true
+}
+
+// checkJSON buffers a JSON body and checks its shape, leaving the body
+// readable for the backend
+func (l *requestLimits) checkJSON(w http.ResponseWriter, req *http.Request) bool {
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeBodyTooLarge(w, req)
+		} else {
+			shared.WriteError(w, req, shared.NewAPIError(http.StatusBadRequest, shared.ErrCodeBadRequest, "Failed to read request body"))
+		}
+		return false
+	}
+
+	if err := shared.CheckJSON(data, l.json); err != nil {
+		shared.WriteDecodeError(w, req, err)
+		return false
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	req.ContentLength = int64(len(data))
+	return true
+}
+
+// headerSize approximates the size of request headers on the wire
+func headerSize(header http.Header) int {
+	size := 0
+	for name, values := range header {
+		for _, value := range values {
+			size += len(name) + len(value) + len(": \r\n")
+		}
+	}
+	return size
+}
+
+// isJSON reports whether a media type is JSON or a JSON-based type
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// writeBodyTooLarge writes the error for a request body over the limit
+func writeBodyTooLarge(w http.ResponseWriter, req *http.Request) {
+	shared.WriteError(w, req, shared.NewAPIError(http.StatusRequestEntityTooLarge, shared.ErrCodePayloadTooLarge, "Request body is too large"))
+}
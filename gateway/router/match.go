@@ -0,0 +1,175 @@
+package router
+
+import (
+	"net"
+	"net/http"
+	"path"
+	"strings"
+
+	"go-inventory-system/shared"
+)
+
+// matcher decides whether a request belongs to a route
+type matcher struct {
+	// segments of the path template; params holds the parameter name of
+	// each {name} segment and "" for literal segments
+	segments []string
+	params   []string
+	host     string
+	headers  map[string]string
+	query    map[string]string
+	// order is the route's position in the config, the final tie-breaker
+	order int
+}
+
+// newMatcher creates a matcher for a route
+func newMatcher(route shared.Route, order int) *matcher {
+	m := &matcher{
+		segments: splitPath(strings.TrimSuffix(route.Path, "/")),
+		host:     strings.ToLower(route.Match.Host),
+		headers:  route.Match.Headers,
+		query:    route.Match.Query,
+		order:    order,
+	}
+	m.params = make([]string, len(m.segments))
+	for i, segment := range m.segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			m.params[i] = segment[1 : len(segment)-1]
+		}
+	}
+	return m
+}
+
+// match reports whether req belongs to the route
+func (m *matcher) match(req *http.Request) bool {
+	if !m.matchHost(req.Host) {
+		return false
+	}
+	for name, value := range m.headers {
+		if !matchValue(req.Header.Values(name), value) {
+			return false
+		}
+	}
+	if len(m.query) > 0 {
+		query := req.URL.Query()
+		for name, value := range m.query {
+			if !matchValue(query[name], value) {
+				return false
+			}
+		}
+	}
+	return m.matchPath(req.URL.Path)
+}
+
+// matchPath matches the template against the leading segments of a path
+func (m *matcher) matchPath(urlPath string) bool {
+	segments := splitPath(urlPath)
+	if len(segments) < len(m.segments) {
+		return false
+	}
+
+	for i, segment := range m.segments {
+		if m.params[i] == "" && segments[i] != segment {
+			return false
+		}
+		if m.params[i] != "" && segments[i] == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// matchHost matches the request host, ignoring the port
+func (m *matcher) matchHost(host string) bool {
+	if m.host == "" {
+		return true
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	if suffix, ok := strings.CutPrefix(m.host, "*"); ok {
+		return strings.HasSuffix(host, suffix) && len(host) > len(suffix)
+	}
+	return host == m.host
+}
+
+// matchValue checks a header or query parameter against an expected value;
+// "*" only requires the parameter to be present
+func matchValue(values []string, expected string) bool {
+	if expected == "*" {
+		return len(values) > 0
+	}
+	for _, value := range values {
+		if value == expected {
+			return true
+		}
+	}
+	return false
+}
+
+// precedes reports whether m should be tried before other. More specific
+// routes win: exact hosts before wildcard hosts before any host, then routes
+// with more header and query conditions, then longer paths, then paths with
+// more literal segments. Remaining ties keep the config order.
+func (m *matcher) precedes(other *matcher) bool {
+	if a, b := m.hostRank(), other.hostRank(); a != b {
+		return a > b
+	}
+	if a, b := len(m.headers)+len(m.query), len(other.headers)+len(other.query); a != b {
+		return a > b
+	}
+	if a, b := len(m.segments), len(other.segments); a != b {
+		return a > b
+	}
+	if a, b := m.literals(), other.literals(); a != b {
+		return a > b
+	}
+	return m.order < other.order
+}
+
+// hostRank orders host conditions by specificity; longer wildcard suffixes
+// are more specific
+func (m *matcher) hostRank() int {
+	switch {
+	case m.host == "":
+		return 0
+	case strings.HasPrefix(m.host, "*"):
+		return len(m.host)
+	default:
+		// Above any wildcard, whose length is bounded by the host name limit
+		return 1 << 16
+	}
+}
+
+// literals counts the literal segments of the path template
+func (m *matcher) literals() int {
+	count := 0
+	for _, param := range m.params {
+		if param == "" {
+			count++
+		}
+	}
+	return count
+}
+
+// splitPath splits a path into its segments
+func splitPath(urlPath string) []string {
+	return strings.Split(strings.TrimPrefix(urlPath, "/"), "/")
+}
+
+// cleanPath returns the canonical form of a path, keeping a trailing slash
+func cleanPath(urlPath string) string {
+	if urlPath == "" {
+		return "/"
+	}
+	if urlPath[0] != '/' {
+		urlPath = "/" + urlPath
+	}
+	cleaned := path.Clean(urlPath)
+	if strings.HasSuffix(urlPath, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
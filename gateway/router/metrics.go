@@ -0,0 +1,66 @@
+package router
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	variantRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_variant_requests_total",
+			Help: "Total number of requests served by each traffic split variant",
+		},
+		[]string{"route", "variant", "status"},
+	)
+
+	variantRequestDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "gateway_variant_request_duration_seconds",
+			Help:    "Duration of requests served by each traffic split variant",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"route", "variant"},
+	)
+
+	mirrorRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_mirror_requests_total",
+			Help: "Total number of mirrored requests by outcome (sent, failed, dropped, skipped)",
+		},
+		[]string{"route", "outcome"},
+	)
+
+	mirrorResponsesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_mirror_responses_total",
+			Help: "Total number of mirrored requests by primary and mirror status",
+		},
+		[]string{"route", "primary_status", "mirror_status"},
+	)
+
+	mirrorStatusMismatchesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_mirror_status_mismatches_total",
+			Help: "Total number of mirrored requests whose status differed from the primary",
+		},
+		[]string{"route"},
+	)
+
+	mirrorRequestDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "gateway_mirror_request_duration_seconds",
+			Help:    "Duration of mirrored requests on the primary and the mirror backend",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"route", "target"},
+	)
+
+	coalescedRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_coalesced_requests_total",
+			Help: "Total number of requests on coalescing routes by role (leader, follower, fallback)",
+		},
+		[]string{"route", "role"},
+	)
+)
@@ -0,0 +1,193 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-inventory-system/gateway/upstream"
+	"go-inventory-system/shared"
+)
+
+// Mirror defaults
+const (
+	defaultMirrorPercentage   = 100
+	defaultMirrorTimeout      = 5 * time.Second
+	defaultMirrorMaxBodyBytes = 64 << 10
+
+	// maxMirrorsInFlight bounds concurrent mirrored requests per route;
+	// requests beyond it are not mirrored
+	maxMirrorsInFlight = 100
+
+	// maxMirrorDrainBytes is how much of a mirrored response is read so the
+	// connection can be reused
+	maxMirrorDrainBytes = 1 << 20
+
+	// mirroredRequestHeader marks requests sent to a mirror backend
+	mirroredRequestHeader = "X-Mirrored-Request"
+)
+
+// hopHeaders are connection-specific headers that are not forwarded
+var hopHeaders = []string{
+	"Connection", "Proxy-Connection", "Keep-Alive", "Proxy-Authenticate",
+	"Proxy-Authorization", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// mirror copies requests to a secondary backend and compares its responses
+// with the primary's
+type mirror struct {
+	route        string
+	pool         *upstream.Pool
+	percentage   float64
+	timeout      time.Duration
+	maxBodyBytes int64
+	inFlight     chan struct{}
+}
+
+// mirrorResult is the outcome of a request on one backend
+type mirrorResult struct {
+	status   int
+	duration time.Duration
+}
+
+// newMirror creates a mirror for a route's mirror config
+func newMirror(route shared.Route, pool *upstream.Pool) *mirror {
+	config := route.Mirror
+	m := &mirror{
+		route:        route.ID(),
+		pool:         pool,
+		percentage:   config.Percentage,
+		timeout:      config.Timeout,
+		maxBodyBytes: config.MaxBodyBytes,
+		inFlight:     make(chan struct{}, maxMirrorsInFlight),
+	}
+	if m.percentage == 0 {
+		m.percentage = defaultMirrorPercentage
+	}
+	if m.timeout == 0 {
+		m.timeout = defaultMirrorTimeout
+	}
+	if m.maxBodyBytes == 0 {
+		m.maxBodyBytes = defaultMirrorMaxBodyBytes
+	}
+	return m
+}
+
+// wrap returns a handler that serves requests with next while mirroring a
+// sample of them in the background
+func (m *mirror) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if rand.Float64()*100 >= m.percentage || upstream.IsStream(req) {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		body, ok := m.copyBody(req)
+		if !ok {
+			mirrorRequestsTotal.WithLabelValues(m.route, "skipped").Inc()
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		select {
+		case m.inFlight <- struct{}{}:
+		default:
+			mirrorRequestsTotal.WithLabelValues(m.route, "dropped").Inc()
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		mirrored, cancel := m.newRequest(req, body)
+		primary := make(chan mirrorResult, 1)
+		go m.send(mirrored, cancel, primary)
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		// Report the primary result even if the proxy aborts the response
+		defer func() {
+			primary <- mirrorResult{status: recorder.Status(), duration: time.Since(start)}
+		}()
+		next.ServeHTTP(recorder, req)
+	})
+}
+
+// copyBody buffers the request body so it can be sent twice. It returns
+// false if the body is too large to mirror, leaving it readable.
+func (m *mirror) copyBody(req *http.Request) ([]byte, bool) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, true
+	}
+	if req.ContentLength > m.maxBodyBytes {
+		return nil, false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(req.Body, m.maxBodyBytes+1))
+	if err != nil || int64(len(body)) > m.maxBodyBytes {
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+		return nil, false
+	}
+
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, true
+}
+
+// newRequest builds the outgoing mirrored request. It is detached from the
+// client's cancellation so mirroring never depends on the client.
+func (m *mirror) newRequest(req *http.Request, body []byte) (*http.Request, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(req.Context()), m.timeout)
+
+	out := req.Clone(ctx)
+	out.RequestURI = ""
+	out.Close = false
+	out.Body = http.NoBody
+	if body != nil {
+		out.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	for _, header := range hopHeaders {
+		out.Header.Del(header)
+	}
+	if _, ok := out.Header["User-Agent"]; !ok {
+		out.Header.Set("User-Agent", "")
+	}
+	out.Header.Set(mirroredRequestHeader, "true")
+	return out, cancel
+}
+
+// send sends a mirrored request and records how it compares to the primary
+func (m *mirror) send(req *http.Request, cancel context.CancelFunc, primary <-chan mirrorResult) {
+	defer func() { <-m.inFlight }()
+	defer cancel()
+
+	start := time.Now()
+	resp, err := m.pool.RoundTrip(req)
+	if err == nil {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxMirrorDrainBytes))
+		resp.Body.Close()
+	}
+	duration := time.Since(start)
+
+	result := <-primary
+	mirrorRequestDuration.WithLabelValues(m.route, "primary").Observe(result.duration.Seconds())
+	if err != nil {
+		mirrorRequestsTotal.WithLabelValues(m.route, "failed").Inc()
+		mirrorStatusMismatchesTotal.WithLabelValues(m.route).Inc()
+		mirrorResponsesTotal.WithLabelValues(m.route, strconv.Itoa(result.status), "error").Inc()
+		return
+	}
+
+	mirrorRequestsTotal.WithLabelValues(m.route, "sent").Inc()
+	mirrorRequestDuration.WithLabelValues(m.route, "mirror").Observe(duration.Seconds())
+	mirrorResponsesTotal.WithLabelValues(m.route, strconv.Itoa(result.status), strconv.Itoa(resp.StatusCode)).Inc()
+	if resp.StatusCode != result.status {
+		mirrorStatusMismatchesTotal.WithLabelValues(m.route).Inc()
+	}
+}
@@ -0,0 +1,91 @@
+package router
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"go-inventory-system/shared"
+)
+
+// rewriter maps a route's public request path to its backend path. Rules
+// apply to the escaped path, so encoded characters such as %2F are kept.
+type rewriter struct {
+	// stripSegments is the number of leading segments removed, matching the route path template
+	stripSegments int
+	addPrefix     string
+	pattern       *regexp.Regexp
+	replacement   string
+}
+
+// newRewriter compiles a route's rewrite rules. It returns nil if the
+// route forwards paths unchanged.
+func newRewriter(route shared.Route) (*rewriter, error) {
+	rules := route.Rewrite
+	if !rules.StripPrefix && rules.AddPrefix == "" && rules.Regex == "" {
+		return nil, nil
+	}
+
+	rw := &rewriter{
+		addPrefix:   (&url.URL{Path: strings.TrimSuffix(rules.AddPrefix, "/")}).EscapedPath(),
+		replacement: rules.Replacement,
+	}
+	if rules.StripPrefix {
+		rw.stripSegments = len(splitPath(strings.TrimSuffix(route.Path, "/")))
+	}
+	if rules.Regex != "" {
+		pattern, err := regexp.Compile(rules.Regex)
+		if err != nil {
+			return nil, err
+		}
+		rw.pattern = pattern
+	}
+	return rw, nil
+}
+
+// rewrite returns a copy of req with the backend path
+func (rw *rewriter) rewrite(req *http.Request) *http.Request {
+	escaped := req.URL.EscapedPath()
+
+	if rw.pattern != nil && rw.pattern.MatchString(escaped) {
+		escaped = rw.pattern.ReplaceAllString(escaped, rw.replacement)
+	}
+	if rw.stripSegments > 0 {
+		escaped = stripSegments(escaped, rw.stripSegments)
+	}
+	if rw.addPrefix != "" {
+		escaped = rw.addPrefix + escaped
+	}
+	if !strings.HasPrefix(escaped, "/") {
+		escaped = "/" + escaped
+	}
+
+	out := new(http.Request)
+	*out = *req
+	out.URL = new(url.URL)
+	*out.URL = *req.URL
+	if path, err := url.PathUnescape(escaped); err == nil {
+		out.URL.Path, out.URL.RawPath = path, escaped
+	} else {
+		// A replacement introduced an invalid escape; forward it literally
+		out.URL.Path, out.URL.RawPath = escaped, ""
+	}
+	return out
+}
+
+// wrap returns a handler forwarding rewritten requests to next
+func (rw *rewriter) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		next.ServeHTTP(w, rw.rewrite(req))
+	})
+}
+
+// stripSegments removes the first n segments of a path
+func stripSegments(path string, n int) string {
+	segments := strings.SplitN(strings.TrimPrefix(path, "/"), "/", n+1)
+	if len(segments) <= n {
+		return ""
+	}
+	return "/" + segments[n]
+}
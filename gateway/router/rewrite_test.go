@@ -0,0 +1,144 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-inventory-system/shared"
+)
+
+func TestRewrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string // route path
+		rewrite  shared.Rewrite
+		target   string // request URI
+		wantPath string // escaped path reaching the backend
+		wantRaw  string // query reaching the backend
+	}{
+		{
+			name:     "unchanged",
+			path:     "/orders",
+			target:   "/orders/5?expand=items",
+			wantPath: "/orders/5",
+			wantRaw:  "expand=items",
+		},
+		{
+			name:     "unchanged keeps encoded slash",
+			path:     "/files",
+			target:   "/files/a%2Fb",
+			wantPath: "/files/a%2Fb",
+		},
+		{
+			name:     "strip prefix",
+			path:     "/api",
+			rewrite:  shared.Rewrite{StripPrefix: true},
+			target:   "/api/users/5?active=true",
+			wantPath: "/users/5",
+			wantRaw:  "active=true",
+		},
+		{
+			name:     "strip prefix of whole path",
+			path:     "/api",
+			rewrite:  shared.Rewrite{StripPrefix: true},
+			target:   "/api",
+			wantPath: "/",
+		},
+		{
+			name:     "strip prefix with template",
+			path:     "/tenants/{tenant}",
+			rewrite:  shared.Rewrite{StripPrefix: true},
+			target:   "/tenants/acme/orders",
+			wantPath: "/orders",
+		},
+		{
+			name:     "strip prefix keeps encoded slash",
+			path:     "/api",
+			rewrite:  shared.Rewrite{StripPrefix: true},
+			target:   "/api/files/a%2Fb",
+			wantPath: "/files/a%2Fb",
+		},
+		{
+			name:     "replace prefix",
+			path:     "/v2/orders",
+			rewrite:  shared.Rewrite{StripPrefix: true, AddPrefix: "/orders/"},
+			target:   "/v2/orders/5",
+			wantPath: "/orders/5",
+		},
+		{
+			name:     "add prefix",
+			path:     "/orders",
+			rewrite:  shared.Rewrite{AddPrefix: "/internal"},
+			target:   "/orders/5",
+			wantPath: "/internal/orders/5",
+		},
+		{
+			name:     "regex with numbered capture",
+			path:     "/items",
+			rewrite:  shared.Rewrite{Regex: `^/items/([0-9]+)/detail$`, Replacement: "/orders/$1"},
+			target:   "/items/42/detail?v=1",
+			wantPath: "/orders/42",
+			wantRaw:  "v=1",
+		},
+		{
+			name:     "regex with named captures",
+			path:     "/users",
+			rewrite:  shared.Rewrite{Regex: `^/users/(?P<user>[0-9]+)/orders/(?P<order>[0-9]+)$`, Replacement: "/orders/${order}/owner/${user}"},
+			target:   "/users/7/orders/42",
+			wantPath: "/orders/42/owner/7",
+		},
+		{
+			name:     "regex without match",
+			path:     "/items",
+			rewrite:  shared.Rewrite{Regex: `^/items/([0-9]+)/detail$`, Replacement: "/orders/$1"},
+			target:   "/items/abc",
+			wantPath: "/items/abc",
+		},
+		{
+			name:     "regex keeps encoded slash",
+			path:     "/docs",
+			rewrite:  shared.Rewrite{Regex: `^/docs/(.+)$`, Replacement: "/files/$1"},
+			target:   "/docs/a%2Fb",
+			wantPath: "/files/a%2Fb",
+		},
+		{
+			name:     "regex then strip then add",
+			path:     "/v1",
+			rewrite:  shared.Rewrite{Regex: `/people/`, Replacement: "/users/", StripPrefix: true, AddPrefix: "/api"},
+			target:   "/v1/people/5",
+			wantPath: "/api/users/5",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw, err := newRewriter(shared.Route{Path: tt.path, Rewrite: tt.rewrite})
+			if err != nil {
+				t.Fatalf("newRewriter: %v", err)
+			}
+			if (rw == nil) != (tt.rewrite == shared.Rewrite{}) {
+				t.Fatalf("newRewriter returned %v for rules %+v", rw, tt.rewrite)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			got := req
+			if rw != nil {
+				got = rw.rewrite(req)
+			}
+
+			if path := got.URL.EscapedPath(); path != tt.wantPath {
+				t.Errorf("escaped path %q, want %q", path, tt.wantPath)
+			}
+			if got.URL.RawQuery != tt.wantRaw {
+				t.Errorf("query %q, want %q", got.URL.RawQuery, tt.wantRaw)
+			}
+			if got.URL.RequestURI() != req.URL.RequestURI() && rw == nil {
+				t.Errorf("request URI changed to %q without rewrite rules", got.URL.RequestURI())
+			}
+			if req.URL.String() != tt.target {
+				t.Errorf("original request changed to %q", req.URL)
+			}
+		})
+	}
+}
@@ -1,69 +1,442 @@
 package router
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"net/http/httputil"
-	"net/url"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"go-inventory-system/gateway/cache"
+	"go-inventory-system/gateway/upstream"
 	"go-inventory-system/shared"
 )
 
-// Router handles routing requests to backend services
+// ErrNotFound is returned when an admin operation names an unknown route or upstream
+var ErrNotFound = errors.New("not found")
+
+// timeoutGracePeriod is added to connection deadlines past a route's total
+// timeout so the gateway can still respond with 504
+const timeoutGracePeriod = time.Second
+
+// Router handles routing requests to backend services. The routing table
+// can be swapped at runtime with Reload; requests already in flight keep
+// using the table they started with.
 type Router struct {
+	table       atomic.Pointer[routeTable]
+	transports  *upstream.Transports
+	retryBudget *upstream.RetryBudget
+	cache       *cache.Cache
+	middlewares []func(http.Handler) http.Handler
+	handler     http.Handler
+
+	// mu serializes reloads and guards drained
+	mu sync.Mutex
+	// drained holds the upstreams drained by an operator, keyed by route
+	// name and upstream URL, so draining survives reloads
+	drained map[drainKey]bool
+	version uint64
+}
+
+// drainKey identifies an upstream of a route
+type drainKey struct {
+	route string
+	url   string
+}
+
+// routeTable is an immutable set of routes and the handlers built from them
+type routeTable struct {
 	routes []shared.Route
-	mux    *http.ServeMux
+	// entries are ordered by precedence; the first match serves the request
+	entries []routeEntry
+	pools   map[string]*upstream.Pool
+	version ConfigVersion
+}
+
+// ConfigVersion identifies the active routing configuration
+type ConfigVersion struct {
+	// Version counts the configurations loaded since the gateway started
+	Version  uint64    `json:"version"`
+	Checksum string    `json:"checksum"`
+	LoadedAt time.Time `json:"loaded_at"`
 }
 
-// NewRouter creates a new router with the given routes
-func NewRouter(routes []shared.Route) *Router {
+// routeEntry pairs a route's matcher with its handler
+type routeEntry struct {
+	matcher *matcher
+	handler http.Handler
+}
+
+// NewRouter creates a new router with the given routes. Retries of all
+// routes are limited by retryBudget, and routes with caching enabled store
+// responses in responseCache.
+func NewRouter(routes []shared.Route, retryBudget *upstream.RetryBudget, responseCache *cache.Cache) (*Router, error) {
+	// Connections to backends, the retry budget and the cache are shared across reloads
 	router := &Router{
-		routes: routes,
-		mux:    http.NewServeMux(),
+		transports:  upstream.NewTransports(),
+		retryBudget: retryBudget,
+		cache:       responseCache,
+		drained:     make(map[drainKey]bool),
+	}
+	router.handler = http.HandlerFunc(router.route)
+
+	if err := router.Reload(routes); err != nil {
+		return nil, err
+	}
+	return router, nil
+}
+
+// Reload builds a routing table from routes and atomically swaps it in.
+// On error the current table is left untouched.
+func (r *Router) Reload(routes []shared.Route) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	table, err := r.buildTable(routes)
+	if err != nil {
+		return err
+	}
+
+	// Upstreams that remain part of their route keep their state
+	old := r.table.Load()
+	for name, pool := range table.pools {
+		for _, u := range pool.Upstreams() {
+			key := drainKey{route: name, url: u.URL.String()}
+			if r.drained[key] {
+				u.SetDrained(true)
+			}
+			if prev := old.upstream(key); prev != nil {
+				u.Inherit(prev)
+			}
+		}
+	}
+
+	r.version++
+	table.version = ConfigVersion{Version: r.version, Checksum: checksum(routes), LoadedAt: time.Now()}
+	if old := r.table.Swap(table); old != nil {
+		old.close()
+		old.removeDropped(table)
+	}
+	return nil
+}
+
+// Version returns the version of the active routing configuration
+func (r *Router) Version() ConfigVersion {
+	return r.table.Load().version
+}
+
+// SetDrained takes an upstream of a route out of rotation, or puts it back.
+// route is the route name as reported by UpstreamStats.
+func (r *Router) SetDrained(route, upstreamURL string, drained bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pool, ok := r.table.Load().pools[route]
+	if !ok {
+		return fmt.Errorf("%w: route %q", ErrNotFound, route)
+	}
+	for _, u := range pool.Upstreams() {
+		if u.URL.String() != upstreamURL {
+			continue
+		}
+
+		u.SetDrained(drained)
+		key := drainKey{route: route, url: upstreamURL}
+		if drained {
+			r.drained[key] = true
+		} else {
+			delete(r.drained, key)
+		}
+		return nil
 	}
+	return fmt.Errorf("%w: upstream %q of route %q", ErrNotFound, upstreamURL, route)
+}
+
+// checksum returns a short digest identifying a set of routes
+func checksum(routes []shared.Route) string {
+	data, _ := json.Marshal(routes)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Close stops background work of the active routing table
+func (r *Router) Close() {
+	if table := r.table.Load(); table != nil {
+		table.close()
+	}
+}
 
-	router.setupRoutes()
-	return router
+// close stops the health checks of every pool in the table
+func (t *routeTable) close() {
+	for _, pool := range t.pools {
+		pool.Close()
+	}
+}
+
+// upstream returns the upstream identified by key, or nil if the table has
+// none. The table may be nil.
+func (t *routeTable) upstream(key drainKey) *upstream.Upstream {
+	if t == nil {
+		return nil
+	}
+	pool, ok := t.pools[key.route]
+	if !ok {
+		return nil
+	}
+	for _, u := range pool.Upstreams() {
+		if u.URL.String() == key.url {
+			return u
+		}
+	}
+	return nil
 }
 
-// setupRoutes configures the routing rules
-func (r *Router) setupRoutes() {
-	for _, route := range r.routes {
-		backendURL, err := url.Parse(route.Backend)
+// removeDropped removes the upstreams that are no longer part of their route
+// in the next table, so their metrics are no longer reported
+func (t *routeTable) removeDropped(next *routeTable) {
+	kept := make(map[drainKey]bool)
+	for name, pool := range next.pools {
+		for _, u := range pool.Upstreams() {
+			kept[drainKey{route: name, url: u.URL.String()}] = true
+		}
+	}
+	for name, pool := range t.pools {
+		for _, u := range pool.Upstreams() {
+			if !kept[drainKey{route: name, url: u.URL.String()}] {
+				u.Remove()
+			}
+		}
+	}
+}
+
+// Routes returns the routes of the active routing table
+func (r *Router) Routes() []shared.Route {
+	return r.table.Load().routes
+}
+
+// UpstreamStats returns per-upstream connection stats keyed by route name
+func (r *Router) UpstreamStats() map[string][]upstream.Stats {
+	stats := make(map[string][]upstream.Stats)
+	for path, pool := range r.table.Load().pools {
+		stats[path] = pool.Stats()
+	}
+	return stats
+}
+
+// buildTable configures the routing rules
+func (r *Router) buildTable(routes []shared.Route) (*routeTable, error) {
+	table := &routeTable{
+		routes: routes,
+		pools:  make(map[string]*upstream.Pool),
+	}
+
+	for i, route := range routes {
+		route := route
+		backend, split, err := r.newBackend(table, route)
 		if err != nil {
-			panic("Invalid backend URL: " + route.Backend)
+			table.close()
+			return nil, fmt.Errorf("route %s: %w", route.ID(), err)
 		}
 
-		proxy := httputil.NewSingleHostReverseProxy(backendURL)
-		proxy.ModifyResponse = r.modifyResponse
+		if route.Coalesce {
+			backend = newCoalescer(route).wrap(backend)
+		}
+
+		rewriter, err := newRewriter(route)
+		if err != nil {
+			table.close()
+			return nil, fmt.Errorf("route %s: invalid rewrite: %w", route.ID(), err)
+		}
+		if rewriter != nil {
+			backend = rewriter.wrap(backend)
+		}
+
+		// Responses are cached under the path the client requested and,
+		// for split routes, the variant serving it
+		backend = r.cache.Wrap(route, backend)
+		if split != nil {
+			backend = split.assign(backend)
+		}
+		cors := newCORSPolicy(route)
+		limits := newRequestLimits(route)
 
 		// Create handler for this route
 		handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			// The gateway answers CORS preflights and sets CORS headers itself
+			if cors != nil && req.Header.Get("Origin") != "" {
+				if isPreflight(req) {
+					cors.preflight(w, req)
+					return
+				}
+				w = cors.wrap(w, req)
+			}
+
 			// Check if method is allowed
 			if !r.isMethodAllowed(req.Method, route.Methods) {
-				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				shared.WriteError(w, req, shared.NewAPIError(http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Method not allowed"))
 				return
 			}
 
+			if !limits.apply(w, req) {
+				return
+			}
+
+			// Streams on streaming routes stay open while traffic flows
+			// instead of being bound by the total timeout
+			if route.Streaming && upstream.IsStream(req) {
+				var stop func()
+				req, stop = withIdleTimeout(w, req, route.Timeouts.Idle)
+				defer stop()
+			} else if route.Timeouts.Total > 0 {
+				var cancel context.CancelFunc
+				req, cancel = withTotalTimeout(w, req, route.Timeouts.Total)
+				defer cancel()
+			}
+
 			// Forward request to backend
-			proxy.ServeHTTP(w, req)
+			backend.ServeHTTP(w, req)
 		})
 
 		// Register route
-		r.mux.Handle(route.Path+"/", http.StripPrefix(route.Path, handler))
-		r.mux.Handle(route.Path, handler)
+		table.entries = append(table.entries, routeEntry{matcher: newMatcher(route, i), handler: handler})
 	}
 
-	// Health check endpoint
-	r.mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
+	sort.Slice(table.entries, func(i, j int) bool {
+		return table.entries[i].matcher.precedes(table.entries[j].matcher)
 	})
+
+	return table, nil
+}
+
+// newBackend creates the upstream pools of a route and returns the handler
+// proxying to them. Routes with a traffic split get a pool per variant, and
+// the returned splitter must assign each request its variant.
+func (r *Router) newBackend(table *routeTable, route shared.Route) (http.Handler, *splitter, error) {
+	transport, err := r.transports.Get(route.TLS)
+	if err != nil {
+		return nil, nil, fmt.Errorf("tls: %w", err)
+	}
+
+	if len(route.Split.Variants) == 0 {
+		pool, err := upstream.NewPool(route, transport, r.retryBudget)
+		if err != nil {
+			return nil, nil, err
+		}
+		table.pools[route.ID()] = pool
+		backend, err := r.withMirror(table, route, transport, r.newProxy(pool))
+		return backend, nil, err
+	}
+
+	split := newSplitter(route)
+	for _, v := range route.Split.Variants {
+		variantRoute := route
+		variantRoute.Name = route.ID() + "/" + v.Name
+		variantRoute.Backend, variantRoute.Upstreams = v.Backend, v.Upstreams
+		variantRoute.Split = shared.TrafficSplit{}
+
+		pool, err := upstream.NewPool(variantRoute, transport, r.retryBudget)
+		if err != nil {
+			return nil, nil, fmt.Errorf("variant %s: %w", v.Name, err)
+		}
+		table.pools[variantRoute.ID()] = pool
+		split.add(v.Name, v.Weight, r.newProxy(pool))
+	}
+	backend, err := r.withMirror(table, route, transport, split)
+	return backend, split, err
+}
+
+// withMirror wraps a route's backend handler to mirror its requests, if the
+// route has a mirror configured. The mirror uses the route's transport and
+// so its TLS settings.
+func (r *Router) withMirror(table *routeTable, route shared.Route, transport http.RoundTripper, backend http.Handler) (http.Handler, error) {
+	if route.Mirror.URL == "" {
+		return backend, nil
+	}
+
+	// Mirrored requests are sent once, without retries or health checks
+	mirrorRoute := shared.Route{Name: route.ID() + "/mirror", Path: route.Path, Backend: route.Mirror.URL}
+	pool, err := upstream.NewPool(mirrorRoute, transport, nil)
+	if err != nil {
+		return nil, fmt.Errorf("mirror: %w", err)
+	}
+	table.pools[mirrorRoute.ID()] = pool
+	return newMirror(route, pool).wrap(backend), nil
+}
+
+// newProxy creates a reverse proxy sending requests through a pool
+func (r *Router) newProxy(pool *upstream.Pool) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Director:       director,
+		Transport:      pool,
+		ModifyResponse: trackIdle,
+		ErrorHandler:   r.proxyError,
+	}
+}
+
+// Use appends a middleware to the chain. Middlewares run in the order they were added.
+func (r *Router) Use(middleware func(http.Handler) http.Handler) {
+	r.middlewares = append(r.middlewares, middleware)
+
+	var handler http.Handler = http.HandlerFunc(r.route)
+	for i := len(r.middlewares) - 1; i >= 0; i-- {
+		handler = r.middlewares[i](handler)
+	}
+	r.handler = handler
 }
 
 // ServeHTTP implements http.Handler
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	r.mux.ServeHTTP(w, req)
+	r.handler.ServeHTTP(w, req)
+}
+
+// route dispatches a request to the most specific matching route
+func (r *Router) route(w http.ResponseWriter, req *http.Request) {
+	// Health check endpoint
+	if req.URL.Path == "/health" {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+		return
+	}
+
+	// Redirect unclean paths so routing decisions cannot be bypassed with dot segments
+	if cleaned := cleanPath(req.URL.Path); cleaned != req.URL.Path {
+		target := *req.URL
+		target.Path, target.RawPath = cleaned, ""
+		http.Redirect(w, req, target.RequestURI(), http.StatusMovedPermanently)
+		return
+	}
+
+	for _, entry := range r.table.Load().entries {
+		if entry.matcher.match(req) {
+			entry.handler.ServeHTTP(w, req)
+			return
+		}
+	}
+	shared.WriteError(w, req, shared.NewAPIError(http.StatusNotFound, shared.ErrCodeNotFound, "No route matches the request"))
+}
+
+// withTotalTimeout bounds a request by a route's total timeout and moves the
+// connection's read and write deadlines to match, so routes may run longer
+// than the server-wide timeouts
+func withTotalTimeout(w http.ResponseWriter, req *http.Request, total time.Duration) (*http.Request, context.CancelFunc) {
+	deadline := time.Now().Add(total)
+
+	// Leave time to write the timeout error after the deadline passes
+	controller := http.NewResponseController(w)
+	controller.SetReadDeadline(deadline.Add(timeoutGracePeriod))
+	controller.SetWriteDeadline(deadline.Add(timeoutGracePeriod))
+
+	ctx, cancel := context.WithDeadline(req.Context(), deadline)
+	return req.WithContext(ctx), cancel
 }
 
 // isMethodAllowed checks if the HTTP method is allowed for the route
@@ -76,12 +449,35 @@ func (r *Router) isMethodAllowed(method string, allowedMethods []string) bool {
 	return false
 }
 
-// modifyResponse can be used to modify responses from backend services
-func (r *Router) modifyResponse(resp *http.Response) error {
-	// Add CORS headers
-	resp.Header.Set("Access-Control-Allow-Origin", "*")
-	resp.Header.Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	resp.Header.Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+// director prepares the outgoing request; the upstream pool fills in the target
+func director(req *http.Request) {
+	if _, ok := req.Header["User-Agent"]; !ok {
+		// Explicitly disable the default User-Agent so it is not set to the Go client's
+		req.Header.Set("User-Agent", "")
+	}
+}
+
+// proxyError converts backend transport failures into structured errors
+func (r *Router) proxyError(w http.ResponseWriter, req *http.Request, err error) {
+	log.Printf("Proxy error for %s %s: %v", req.Method, req.URL.Path, err)
 
-	return nil
+	if errors.Is(err, upstream.ErrCircuitOpen) {
+		shared.WriteError(w, req, shared.NewAPIError(http.StatusServiceUnavailable, shared.ErrCodeCircuitOpen, "Backend service is failing, try again later"))
+		return
+	}
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		writeBodyTooLarge(w, req)
+		return
+	}
+	if errors.Is(err, upstream.ErrNoUpstream) {
+		shared.WriteError(w, req, shared.NewAPIError(http.StatusServiceUnavailable, shared.ErrCodeServiceUnavailable, "No backend instance available"))
+		return
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		shared.WriteError(w, req, shared.NewAPIError(http.StatusGatewayTimeout, shared.ErrCodeGatewayTimeout, "Backend service timed out"))
+		return
+	}
+	shared.WriteError(w, req, shared.NewAPIError(http.StatusBadGateway, shared.ErrCodeBadGateway, "Backend service unavailable"))
 }
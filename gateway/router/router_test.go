@@ -0,0 +1,102 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-inventory-system/gateway/upstream"
+	"go-inventory-system/shared"
+)
+
+// onlyUpstream returns the stats of the only upstream of a route
+func onlyUpstream(t *testing.T, r *Router, route string) upstream.Stats {
+	t.Helper()
+
+	stats := r.UpstreamStats()[route]
+	if len(stats) != 1 {
+		t.Fatalf("route %s has %d upstreams, want 1", route, len(stats))
+	}
+	return stats[0]
+}
+
+func TestReloadKeepsEjectedUpstreams(t *testing.T) {
+	// A server that is closed refuses connections, so every request fails
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	routes := []shared.Route{{
+		Path:      "/orders",
+		Upstreams: []shared.Upstream{{URL: down.URL}},
+		HealthCheck: shared.HealthCheck{
+			MaxFailures:   1,
+			EjectDuration: time.Hour,
+		},
+		Methods: []string{"GET"},
+	}}
+	r, err := NewRouter(routes, nil, nil)
+	if err != nil {
+		t.Fatalf("new router: %v", err)
+	}
+	defer r.Close()
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders", nil))
+	if onlyUpstream(t, r, "/orders").Healthy {
+		t.Fatal("upstream still healthy after a failed request")
+	}
+
+	if err := r.Reload(routes); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if onlyUpstream(t, r, "/orders").Healthy {
+		t.Error("upstream back in rotation after reloading unchanged routes")
+	}
+
+	// An upstream whose URL changed starts out healthy
+	routes[0].Upstreams[0].URL = down.URL + "/v2"
+	if err := r.Reload(routes); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if !onlyUpstream(t, r, "/orders").Healthy {
+		t.Error("new upstream is not in rotation")
+	}
+}
+
+func TestReloadKeepsOpenCircuits(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	routes := []shared.Route{{
+		Path:      "/orders",
+		Upstreams: []shared.Upstream{{URL: down.URL}},
+		CircuitBreaker: shared.CircuitBreaker{
+			Enabled:         true,
+			MinimumRequests: 1,
+			OpenDuration:    time.Hour,
+		},
+		Methods: []string{"GET"},
+	}}
+	r, err := NewRouter(routes, nil, nil)
+	if err != nil {
+		t.Fatalf("new router: %v", err)
+	}
+	defer r.Close()
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders", nil))
+	if state := onlyUpstream(t, r, "/orders").CircuitState; state != "open" {
+		t.Fatalf("circuit %s after a failed request, want open", state)
+	}
+
+	if err := r.Reload(routes); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if state := onlyUpstream(t, r, "/orders").CircuitState; state != "open" {
+		t.Errorf("circuit %s after reloading unchanged routes, want open", state)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/orders", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status %d with an open circuit, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
@@ -0,0 +1,200 @@
+package router
+
+import (
+	"bufio"
+	"hash/fnv"
+	"math/rand"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-inventory-system/gateway/upstream"
+	"go-inventory-system/shared"
+)
+
+const (
+	// defaultOverrideHeader forces a variant by name
+	defaultOverrideHeader = "X-Variant"
+
+	// variantCookieMaxAge is how long cookie stickiness lasts
+	variantCookieMaxAge = 7 * 24 * time.Hour
+)
+
+// cookieUnsafe matches characters not allowed in derived cookie names
+var cookieUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// splitter sends each request of a route to one of its variants
+type splitter struct {
+	route          string
+	variants       []*variant
+	totalWeight    int
+	sticky         string
+	cookie         string
+	overrideHeader string
+}
+
+// variant is one backend group of a split route
+type variant struct {
+	name   string
+	weight int
+	proxy  http.Handler
+}
+
+// newSplitter creates a splitter for a route's traffic split. Variants must
+// be added with add.
+func newSplitter(route shared.Route) *splitter {
+	split := route.Split
+	s := &splitter{
+		route:          route.ID(),
+		sticky:         split.Sticky,
+		cookie:         split.Cookie,
+		overrideHeader: split.OverrideHeader,
+	}
+	if s.cookie == "" {
+		s.cookie = "gw_variant_" + strings.Trim(cookieUnsafe.ReplaceAllString(route.ID(), "_"), "_")
+	}
+	if s.overrideHeader == "" {
+		s.overrideHeader = defaultOverrideHeader
+	}
+	return s
+}
+
+// add appends a variant to the split
+func (s *splitter) add(name string, weight int, proxy http.Handler) {
+	s.variants = append(s.variants, &variant{name: name, weight: weight, proxy: proxy})
+	s.totalWeight += weight
+}
+
+// assign returns a handler choosing the variant of each request before
+// passing it to next, so handlers in between such as the cache can tell
+// variants apart
+func (s *splitter) assign(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		v, assigned := s.choose(req)
+		if assigned && s.sticky == shared.StickyCookie {
+			http.SetCookie(w, &http.Cookie{
+				Name:     s.cookie,
+				Value:    v.name,
+				Path:     "/",
+				MaxAge:   int(variantCookieMaxAge.Seconds()),
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+		next.ServeHTTP(w, upstream.WithVariant(req, v.name))
+	})
+}
+
+// ServeHTTP proxies a request to the variant chosen by assign and records
+// per-variant metrics
+func (s *splitter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	v := s.lookup(upstream.Variant(req))
+	if v == nil {
+		v, _ = s.choose(req)
+	}
+
+	start := time.Now()
+	recorder := &statusRecorder{ResponseWriter: w}
+	v.proxy.ServeHTTP(recorder, req)
+
+	variantRequestsTotal.WithLabelValues(s.route, v.name, strconv.Itoa(recorder.Status())).Inc()
+	variantRequestDuration.WithLabelValues(s.route, v.name).Observe(time.Since(start).Seconds())
+}
+
+// choose picks the variant for a request. The override header wins, then a
+// sticky assignment, then a weighted random choice. assigned reports whether
+// the variant was newly assigned rather than forced or remembered.
+func (s *splitter) choose(req *http.Request) (v *variant, assigned bool) {
+	if v := s.lookup(req.Header.Get(s.overrideHeader)); v != nil {
+		return v, false
+	}
+
+	switch s.sticky {
+	case shared.StickyUser:
+		if userID := upstream.UserID(req); userID != "" {
+			h := fnv.New32a()
+			h.Write([]byte(s.route))
+			h.Write([]byte{0})
+			h.Write([]byte(userID))
+			return s.at(int(h.Sum32() % uint32(s.totalWeight))), false
+		}
+	case shared.StickyCookie:
+		if cookie, err := req.Cookie(s.cookie); err == nil {
+			// A variant whose weight dropped to zero no longer keeps its clients
+			if v := s.lookup(cookie.Value); v != nil && v.weight > 0 {
+				return v, false
+			}
+		}
+	}
+
+	return s.at(rand.Intn(s.totalWeight)), true
+}
+
+// lookup finds a variant by name
+func (s *splitter) lookup(name string) *variant {
+	if name == "" {
+		return nil
+	}
+	for _, v := range s.variants {
+		if v.name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// at returns the variant owning a point in [0, totalWeight)
+func (s *splitter) at(point int) *variant {
+	for _, v := range s.variants {
+		if point < v.weight {
+			return v
+		}
+		point -= v.weight
+	}
+	return s.variants[len(s.variants)-1]
+}
+
+// statusRecorder captures the status code written to a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// Hijack implements http.Hijacker, recording a protocol upgrade
+func (rec *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(rec.ResponseWriter).Hijack()
+	if err == nil && rec.status == 0 {
+		rec.status = http.StatusSwitchingProtocols
+	}
+	return conn, brw, err
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// Status returns the status code of the response
+func (rec *statusRecorder) Status() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
@@ -0,0 +1,112 @@
+package router
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// defaultIdleTimeout closes streams of routes without their own idle timeout
+const defaultIdleTimeout = 60 * time.Second
+
+// idleTimerKey is the context key for a stream's idle timer
+type idleTimerKey struct{}
+
+// idleTimer ends a stream once no traffic has passed for its timeout
+type idleTimer struct {
+	timeout time.Duration
+
+	mu      sync.Mutex
+	timer   *time.Timer
+	stopped bool
+}
+
+// withIdleTimeout prepares a streamed request. The server's read and write
+// deadlines are lifted so the stream can outlive them; instead the request
+// is cancelled once the backend connection sees no traffic for idle.
+func withIdleTimeout(w http.ResponseWriter, req *http.Request, idle time.Duration) (*http.Request, func()) {
+	if idle == 0 {
+		idle = defaultIdleTimeout
+	}
+
+	controller := http.NewResponseController(w)
+	controller.SetReadDeadline(time.Time{})
+	controller.SetWriteDeadline(time.Time{})
+
+	ctx, cancel := context.WithCancel(req.Context())
+	t := &idleTimer{timeout: idle}
+	t.timer = time.AfterFunc(idle, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.stopped {
+			return
+		}
+		cancel()
+		// Unblock writes to a client that stopped reading
+		controller.SetWriteDeadline(time.Now())
+	})
+
+	stop := func() {
+		t.mu.Lock()
+		t.stopped = true
+		t.timer.Stop()
+		t.mu.Unlock()
+		cancel()
+	}
+	return req.WithContext(context.WithValue(ctx, idleTimerKey{}, t)), stop
+}
+
+// reset restarts the timer after traffic
+func (t *idleTimer) reset() {
+	t.mu.Lock()
+	if !t.stopped {
+		t.timer.Reset(t.timeout)
+	}
+	t.mu.Unlock()
+}
+
+// trackIdle makes traffic through the body of a streamed response reset the
+// request's idle timer. For upgraded connections the body carries both
+// directions. It is meant for httputil.ReverseProxy.ModifyResponse.
+func trackIdle(res *http.Response) error {
+	t, ok := res.Request.Context().Value(idleTimerKey{}).(*idleTimer)
+	if !ok {
+		return nil
+	}
+
+	body := &idleBody{ReadCloser: res.Body, timer: t}
+	if rw, ok := res.Body.(io.ReadWriteCloser); ok {
+		res.Body = &idleReadWriteBody{idleBody: body, writer: rw}
+	} else {
+		res.Body = body
+	}
+	return nil
+}
+
+type idleBody struct {
+	io.ReadCloser
+	timer *idleTimer
+}
+
+func (b *idleBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.timer.reset()
+	}
+	return n, err
+}
+
+type idleReadWriteBody struct {
+	*idleBody
+	writer io.Writer
+}
+
+func (b *idleReadWriteBody) Write(p []byte) (int, error) {
+	n, err := b.writer.Write(p)
+	if n > 0 {
+		b.timer.reset()
+	}
+	return n, err
+}
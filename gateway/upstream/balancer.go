@@ -0,0 +1,147 @@
+package upstream
+
+import (
+	"hash/fnv"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"go-inventory-system/shared"
+)
+
+// Balancer picks an upstream for a request from the available candidates
+type Balancer interface {
+	Next(r *http.Request, candidates []*Upstream) *Upstream
+}
+
+// NewBalancer creates the balancer for a load balancing strategy
+func NewBalancer(config shared.LoadBalancing) Balancer {
+	switch config.Strategy {
+	case shared.LoadBalanceLeastConnections:
+		return &leastConnections{}
+	case shared.LoadBalanceWeighted:
+		return &weighted{}
+	case shared.LoadBalanceConsistentHash:
+		return &consistentHash{header: config.HashHeader}
+	default:
+		return &roundRobin{}
+	}
+}
+
+// roundRobin cycles through the candidates in order
+type roundRobin struct {
+	counter atomic.Uint64
+}
+
+func (b *roundRobin) Next(r *http.Request, candidates []*Upstream) *Upstream {
+	if len(candidates) == 0 {
+		return nil
+	}
+	n := b.counter.Add(1) - 1
+	return candidates[n%uint64(len(candidates))]
+}
+
+// leastConnections picks the candidate with the fewest in-flight requests,
+// rotating the starting point so ties are spread evenly
+type leastConnections struct {
+	counter atomic.Uint64
+}
+
+func (b *leastConnections) Next(r *http.Request, candidates []*Upstream) *Upstream {
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	start := int((b.counter.Add(1) - 1) % uint64(len(candidates)))
+	var best *Upstream
+	for i := range candidates {
+		candidate := candidates[(start+i)%len(candidates)]
+		if best == nil || candidate.ActiveConnections() < best.ActiveConnections() {
+			best = candidate
+		}
+	}
+	return best
+}
+
+// weighted implements smooth weighted round-robin, which interleaves
+// upstreams in proportion to their weights
+type weighted struct {
+	mu sync.Mutex
+}
+
+func (b *weighted) Next(r *http.Request, candidates []*Upstream) *Upstream {
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	total := 0
+	var best *Upstream
+	for _, candidate := range candidates {
+		candidate.currentWeight += candidate.Weight
+		total += candidate.Weight
+		if best == nil || candidate.currentWeight > best.currentWeight {
+			best = candidate
+		}
+	}
+	best.currentWeight -= total
+	return best
+}
+
+// consistentHash maps a request key to an upstream using weighted rendezvous
+// hashing, so each key sticks to one upstream and only keys of a removed
+// upstream move. Requests without a key fall back to round-robin.
+type consistentHash struct {
+	header   string
+	fallback roundRobin
+}
+
+func (b *consistentHash) Next(r *http.Request, candidates []*Upstream) *Upstream {
+	key := b.key(r)
+	if key == "" {
+		return b.fallback.Next(r, candidates)
+	}
+
+	var best *Upstream
+	bestScore := math.Inf(-1)
+	for _, candidate := range candidates {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write([]byte(candidate.URL.String()))
+
+		// Map the hash into (0, 1) and weight it
+		u := (float64(h.Sum64()>>11) + 0.5) / (1 << 53)
+		score := -float64(candidate.Weight) / math.Log(u)
+		if score > bestScore {
+			best, bestScore = candidate, score
+		}
+	}
+	return best
+}
+
+// key returns the value hashed for a request
+func (b *consistentHash) key(r *http.Request) string {
+	if b.header != "" {
+		return r.Header.Get(b.header)
+	}
+	return UserID(r)
+}
+
+// UserID returns the authenticated user ID of a request, taken from the
+// auth middleware's context or the bearer token, or "" if there is none
+func UserID(r *http.Request) string {
+	if userID, ok := r.Context().Value("user_id").(uint); ok {
+		return strconv.FormatUint(uint64(userID), 10)
+	}
+	if token, err := shared.ExtractTokenFromHeader(r); err == nil {
+		if claims, err := shared.ValidateJWT(token); err == nil {
+			return strconv.FormatUint(uint64(claims.UserID), 10)
+		}
+	}
+	return ""
+}
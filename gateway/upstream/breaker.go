@@ -0,0 +1,286 @@
+package upstream
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"go-inventory-system/shared"
+)
+
+// Circuit breaker defaults
+const (
+	defaultFailureRateThreshold  = 50
+	defaultSlowCallRateThreshold = 100
+	defaultMinimumRequests       = 10
+	defaultBreakerWindow         = 30 * time.Second
+	defaultOpenDuration          = 30 * time.Second
+	defaultHalfOpenRequests      = 3
+
+	// breakerBuckets is the number of buckets the sliding window is split into
+	breakerBuckets = 10
+)
+
+// CircuitState is the state of a circuit breaker
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// breakerBucket holds call counts for one slice of the sliding window
+type breakerBucket struct {
+	start    time.Time
+	total    int
+	failures int
+	slow     int
+}
+
+// Breaker is a circuit breaker guarding a single upstream. A nil Breaker
+// allows every request.
+type Breaker struct {
+	config   shared.CircuitBreaker
+	route    string
+	upstream string
+
+	mu               sync.Mutex
+	state            CircuitState
+	openedAt         time.Time
+	buckets          [breakerBuckets]breakerBucket
+	halfOpenInFlight int
+	halfOpenSuccess  int
+	removed          bool
+}
+
+// newBreaker creates a breaker for an upstream, or nil if breaking is disabled
+func newBreaker(config shared.CircuitBreaker, route, upstream string) *Breaker {
+	if !config.Enabled {
+		return nil
+	}
+
+	if config.FailureRateThreshold <= 0 {
+		config.FailureRateThreshold = defaultFailureRateThreshold
+	}
+	if config.SlowCallRateThreshold <= 0 {
+		config.SlowCallRateThreshold = defaultSlowCallRateThreshold
+	}
+	if config.MinimumRequests <= 0 {
+		config.MinimumRequests = defaultMinimumRequests
+	}
+	if config.Window <= 0 {
+		config.Window = defaultBreakerWindow
+	}
+	if config.OpenDuration <= 0 {
+		config.OpenDuration = defaultOpenDuration
+	}
+	if config.HalfOpenRequests <= 0 {
+		config.HalfOpenRequests = defaultHalfOpenRequests
+	}
+
+	breakerState.WithLabelValues(route, upstream).Set(float64(CircuitClosed))
+	return &Breaker{config: config, route: route, upstream: upstream}
+}
+
+// State returns the current state of the breaker
+func (b *Breaker) State() CircuitState {
+	if b == nil {
+		return CircuitClosed
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expireOpen(time.Now())
+	return b.state
+}
+
+// Allow reports whether a request may be sent. In the half-open state it
+// reserves one of the trial slots, so every allowed request must be followed
+// by a call to Record.
+func (b *Breaker) Allow() bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expireOpen(time.Now())
+
+	switch b.state {
+	case CircuitOpen:
+		return false
+	case CircuitHalfOpen:
+		if b.halfOpenInFlight+b.halfOpenSuccess >= b.config.HalfOpenRequests {
+			return false
+		}
+		b.halfOpenInFlight++
+	}
+	return true
+}
+
+// isFailureStatus reports whether a response status counts as a failed call
+func (b *Breaker) isFailureStatus(code int) bool {
+	if b == nil {
+		return false
+	}
+	if len(b.config.FailureStatuses) == 0 {
+		return code >= 500
+	}
+	for _, status := range b.config.FailureStatuses {
+		if code == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Record records the outcome of a request allowed by Allow
+func (b *Breaker) Record(failed bool, latency time.Duration) {
+	if b == nil {
+		return
+	}
+
+	slow := b.config.SlowCallDuration > 0 && latency > b.config.SlowCallDuration
+	now := time.Now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitHalfOpen:
+		// Requests allowed before the breaker opened may still be finishing
+		if b.halfOpenInFlight > 0 {
+			b.halfOpenInFlight--
+		}
+		if failed || slow {
+			b.transition(CircuitOpen, now)
+			return
+		}
+		b.halfOpenSuccess++
+		if b.halfOpenSuccess >= b.config.HalfOpenRequests {
+			b.transition(CircuitClosed, now)
+		}
+
+	case CircuitClosed:
+		bucket := b.bucket(now)
+		bucket.total++
+		if failed {
+			bucket.failures++
+		}
+		if slow {
+			bucket.slow++
+		}
+
+		total, failures, slowCalls := b.counts(now)
+		if total < b.config.MinimumRequests {
+			return
+		}
+		failureRate := float64(failures) * 100 / float64(total)
+		slowRate := float64(slowCalls) * 100 / float64(total)
+		if failureRate >= b.config.FailureRateThreshold ||
+			(b.config.SlowCallDuration > 0 && slowRate >= b.config.SlowCallRateThreshold) {
+			b.transition(CircuitOpen, now)
+		}
+	}
+}
+
+// expireOpen moves an open breaker to half-open once OpenDuration has passed.
+// Callers must hold b.mu.
+func (b *Breaker) expireOpen(now time.Time) {
+	if b.state == CircuitOpen && now.Sub(b.openedAt) >= b.config.OpenDuration {
+		b.transition(CircuitHalfOpen, now)
+	}
+}
+
+// transition changes the breaker state and resets the counters for the new
+// state. Callers must hold b.mu.
+func (b *Breaker) transition(state CircuitState, now time.Time) {
+	log.Printf("Circuit breaker for upstream %s of route %s: %s -> %s", b.upstream, b.route, b.state, state)
+
+	b.state = state
+	b.halfOpenInFlight = 0
+	b.halfOpenSuccess = 0
+	switch state {
+	case CircuitOpen:
+		b.openedAt = now
+	case CircuitClosed:
+		b.buckets = [breakerBuckets]breakerBucket{}
+	}
+
+	if !b.removed {
+		breakerState.WithLabelValues(b.route, b.upstream).Set(float64(state))
+	}
+	breakerTransitionsTotal.WithLabelValues(b.route, b.upstream, state.String()).Inc()
+}
+
+// inherit copies the state and window of prev, so a breaker that was open
+// before a reload stays open. Requests allowed by prev are recorded by prev,
+// so none of them count as in flight here.
+func (b *Breaker) inherit(prev *Breaker) {
+	if b == nil || prev == nil {
+		return
+	}
+
+	prev.mu.Lock()
+	state, openedAt, buckets := prev.state, prev.openedAt, prev.buckets
+	halfOpenSuccess := prev.halfOpenSuccess
+	prev.mu.Unlock()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = state
+	b.openedAt = openedAt
+	b.buckets = buckets
+	b.halfOpenSuccess = halfOpenSuccess
+	if !b.removed {
+		breakerState.WithLabelValues(b.route, b.upstream).Set(float64(state))
+	}
+}
+
+// remove deletes the breaker's state gauge and stops updating it
+func (b *Breaker) remove() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.removed = true
+	breakerState.DeleteLabelValues(b.route, b.upstream)
+}
+
+// bucket returns the window bucket for now, clearing it if it is stale.
+// Callers must hold b.mu.
+func (b *Breaker) bucket(now time.Time) *breakerBucket {
+	width := b.config.Window / breakerBuckets
+	start := now.Truncate(width)
+	bucket := &b.buckets[(start.UnixNano()/int64(width))%breakerBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = breakerBucket{start: start}
+	}
+	return bucket
+}
+
+// counts sums the buckets that fall inside the window. Callers must hold b.mu.
+func (b *Breaker) counts(now time.Time) (total, failures, slow int) {
+	for _, bucket := range b.buckets {
+		if now.Sub(bucket.start) < b.config.Window {
+			total += bucket.total
+			failures += bucket.failures
+			slow += bucket.slow
+		}
+	}
+	return total, failures, slow
+}
@@ -0,0 +1,197 @@
+package upstream
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"go-inventory-system/shared"
+)
+
+// Health check defaults
+const (
+	defaultHealthPath         = "/health"
+	defaultHealthTimeout      = 2 * time.Second
+	defaultHealthyThreshold   = 2
+	defaultUnhealthyThreshold = 3
+	defaultEjectDuration      = 30 * time.Second
+)
+
+// healthState tracks whether an upstream is in rotation
+type healthState struct {
+	mu              sync.Mutex
+	healthy         bool
+	probeSuccesses  int
+	probeFailures   int
+	requestFailures int
+	ejectedUntil    time.Time
+}
+
+// withHealthDefaults fills in unset health check settings
+func withHealthDefaults(config shared.HealthCheck) shared.HealthCheck {
+	if config.Path == "" {
+		config.Path = defaultHealthPath
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaultHealthTimeout
+	}
+	if config.HealthyThreshold <= 0 {
+		config.HealthyThreshold = defaultHealthyThreshold
+	}
+	if config.UnhealthyThreshold <= 0 {
+		config.UnhealthyThreshold = defaultUnhealthyThreshold
+	}
+	if config.EjectDuration <= 0 {
+		config.EjectDuration = defaultEjectDuration
+	}
+	return config
+}
+
+// Healthy reports whether the upstream is in rotation. Passively ejected
+// upstreams are reintroduced once their ejection expires, unless active
+// checks are enabled, in which case probes decide.
+func (u *Upstream) Healthy() bool {
+	u.health.mu.Lock()
+	defer u.health.mu.Unlock()
+
+	if !u.health.healthy && u.healthConfig.Interval <= 0 && time.Now().After(u.health.ejectedUntil) {
+		u.setHealthy(true, "ejection expired")
+	}
+	return u.health.healthy
+}
+
+// recordProbe updates health state with the result of an active probe
+func (u *Upstream) recordProbe(ok bool) {
+	u.health.mu.Lock()
+	defer u.health.mu.Unlock()
+
+	if ok {
+		u.health.probeFailures = 0
+		u.health.probeSuccesses++
+		if !u.health.healthy && u.health.probeSuccesses >= u.healthConfig.HealthyThreshold {
+			u.setHealthy(true, "health check passed")
+		}
+		return
+	}
+
+	u.health.probeSuccesses = 0
+	u.health.probeFailures++
+	if u.health.healthy && u.health.probeFailures >= u.healthConfig.UnhealthyThreshold {
+		u.setHealthy(false, "health check failed")
+	}
+}
+
+// recordRequest updates passive health state with the outcome of a proxied request
+func (u *Upstream) recordRequest(failed bool) {
+	if u.healthConfig.MaxFailures <= 0 {
+		return
+	}
+
+	u.health.mu.Lock()
+	defer u.health.mu.Unlock()
+
+	if !failed {
+		u.health.requestFailures = 0
+		return
+	}
+
+	u.health.requestFailures++
+	if u.health.healthy && u.health.requestFailures >= u.healthConfig.MaxFailures {
+		u.health.ejectedUntil = time.Now().Add(u.healthConfig.EjectDuration)
+		u.setHealthy(false, "consecutive request failures")
+	}
+}
+
+// setHealthy changes the health state and resets the counters. Callers must hold u.health.mu.
+func (u *Upstream) setHealthy(healthy bool, reason string) {
+	u.health.healthy = healthy
+	u.health.probeSuccesses = 0
+	u.health.probeFailures = 0
+	u.health.requestFailures = 0
+
+	value := 0.0
+	if healthy {
+		value = 1
+		log.Printf("Upstream %s of route %s restored: %s", u.URL, u.route, reason)
+	} else {
+		upstreamEjectionsTotal.WithLabelValues(u.route, u.URL.String()).Inc()
+		log.Printf("Upstream %s of route %s ejected: %s", u.URL, u.route, reason)
+	}
+	if !u.removed.Load() {
+		upstreamHealthy.WithLabelValues(u.route, u.URL.String()).Set(value)
+	}
+}
+
+// inheritHealth copies the health state of prev
+func (u *Upstream) inheritHealth(prev *Upstream) {
+	prev.health.mu.Lock()
+	healthy := prev.health.healthy
+	probeSuccesses, probeFailures := prev.health.probeSuccesses, prev.health.probeFailures
+	requestFailures := prev.health.requestFailures
+	ejectedUntil := prev.health.ejectedUntil
+	prev.health.mu.Unlock()
+
+	u.health.mu.Lock()
+	defer u.health.mu.Unlock()
+	u.health.healthy = healthy
+	u.health.probeSuccesses = probeSuccesses
+	u.health.probeFailures = probeFailures
+	u.health.requestFailures = requestFailures
+	u.health.ejectedUntil = ejectedUntil
+
+	if !healthy && !u.removed.Load() {
+		upstreamHealthy.WithLabelValues(u.route, u.URL.String()).Set(0)
+	}
+}
+
+// runHealthChecks probes every upstream in the pool until ctx is cancelled
+func (p *Pool) runHealthChecks(ctx context.Context, config shared.HealthCheck) {
+	client := &http.Client{Transport: p.transport, Timeout: config.Timeout}
+
+	ticker := time.NewTicker(config.Interval)
+	defer ticker.Stop()
+
+	for {
+		var wg sync.WaitGroup
+		for _, upstream := range p.upstreams {
+			wg.Add(1)
+			go func(upstream *Upstream) {
+				defer wg.Done()
+				ok := probe(ctx, client, upstream.URL, config.Path)
+				if ctx.Err() == nil {
+					upstream.recordProbe(ok)
+				}
+			}(upstream)
+		}
+		wg.Wait()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe sends a health check request and reports whether it succeeded
+func probe(ctx context.Context, client *http.Client, target *url.URL, path string) bool {
+	probeURL := *target
+	probeURL.Path = singleJoiningSlash(target.Path, path)
+	probeURL.RawPath = ""
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL.String(), nil)
+	if err != nil {
+		return false
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode >= 200 && resp.StatusCode < 400
+}
@@ -0,0 +1,72 @@
+package upstream
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	upstreamRequestsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_upstream_requests_total",
+			Help: "Total number of requests proxied to each upstream",
+		},
+		[]string{"route", "upstream", "status"},
+	)
+
+	activeConnections = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_upstream_active_connections",
+			Help: "Number of in-flight requests to each upstream",
+		},
+		[]string{"route", "upstream"},
+	)
+
+	upstreamHealthy = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_upstream_healthy",
+			Help: "Whether each upstream is in rotation (1) or ejected (0)",
+		},
+		[]string{"route", "upstream"},
+	)
+
+	upstreamEjectionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_upstream_ejections_total",
+			Help: "Total number of times each upstream was ejected from rotation",
+		},
+		[]string{"route", "upstream"},
+	)
+
+	breakerState = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "gateway_circuit_breaker_state",
+			Help: "Circuit breaker state of each upstream (0 closed, 1 open, 2 half-open)",
+		},
+		[]string{"route", "upstream"},
+	)
+
+	breakerTransitionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_circuit_breaker_transitions_total",
+			Help: "Total number of circuit breaker state transitions",
+		},
+		[]string{"route", "upstream", "state"},
+	)
+
+	retriesTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_upstream_retries_total",
+			Help: "Total number of retried requests per route",
+		},
+		[]string{"route"},
+	)
+
+	retryBudgetExhaustedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_retry_budget_exhausted_total",
+			Help: "Total number of retries skipped because the retry budget was exhausted",
+		},
+		[]string{"route"},
+	)
+)
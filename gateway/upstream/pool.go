@@ -0,0 +1,305 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-inventory-system/shared"
+)
+
+var (
+	// ErrNoUpstream is returned when a route has no healthy upstream
+	ErrNoUpstream = errors.New("no upstream available")
+
+	// ErrCircuitOpen is returned when every healthy upstream has an open circuit breaker
+	ErrCircuitOpen = errors.New("circuit breaker open")
+)
+
+// Pool is the set of upstreams behind a route. It implements http.RoundTripper,
+// sending each request to the upstream chosen by its balancer.
+type Pool struct {
+	route     string
+	upstreams []*Upstream
+	balancer  Balancer
+	transport http.RoundTripper
+	retry     shared.RetryPolicy
+	timeouts  shared.RouteTimeouts
+	streaming bool
+	budget    *RetryBudget
+	stop      context.CancelFunc
+}
+
+// NewPool creates a pool for a route's upstreams and starts active health
+// checks if they are configured. Close must be called to stop them.
+// Retries of every pool sharing budget are limited by it; a nil budget
+// does not limit retries.
+func NewPool(route shared.Route, transport http.RoundTripper, budget *RetryBudget) (*Pool, error) {
+	pool := &Pool{
+		route:     route.ID(),
+		balancer:  NewBalancer(route.LoadBalancing),
+		transport: transport,
+		retry:     withRetryDefaults(route.Retry),
+		timeouts:  route.Timeouts,
+		streaming: route.Streaming,
+		budget:    budget,
+	}
+
+	healthConfig := withHealthDefaults(route.HealthCheck)
+	for _, upstream := range route.AllUpstreams() {
+		target, err := url.Parse(upstream.URL)
+		if err != nil {
+			return nil, err
+		}
+		pool.upstreams = append(pool.upstreams, newUpstream(route, target, upstream.Weight, healthConfig))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pool.stop = cancel
+	if healthConfig.Interval > 0 {
+		go pool.runHealthChecks(ctx, healthConfig)
+	}
+
+	return pool, nil
+}
+
+// Close stops the pool's background health checks
+func (p *Pool) Close() {
+	p.stop()
+}
+
+// Upstreams returns the upstreams in the pool
+func (p *Pool) Upstreams() []*Upstream {
+	return p.upstreams
+}
+
+// Stats returns connection stats for every upstream in the pool
+func (p *Pool) Stats() []Stats {
+	stats := make([]Stats, len(p.upstreams))
+	for i, upstream := range p.upstreams {
+		stats[i] = upstream.Stats()
+	}
+	return stats
+}
+
+// RoundTrip implements http.RoundTripper. Failed attempts are retried on
+// another upstream when the route's retry policy and the retry budget allow.
+func (p *Pool) RoundTrip(req *http.Request) (*http.Response, error) {
+	p.budget.deposit()
+
+	maxAttempts := p.retry.MaxAttempts
+	if maxAttempts > 1 && isRetryable(req) {
+		// Work on a shallow copy so the caller's request body is left alone
+		copied := *req
+		req = &copied
+
+		replayable, err := bufferBody(req, p.retry.MaxBodyBytes)
+		if err != nil {
+			return nil, err
+		}
+		if !replayable {
+			maxAttempts = 1
+		}
+	} else {
+		maxAttempts = 1
+	}
+
+	tried := make(map[*Upstream]bool)
+	for attempt := 1; ; attempt++ {
+		resp, err := p.attempt(req, tried)
+		if attempt >= maxAttempts || !shouldRetry(req.Context(), p.retry, resp, err) {
+			return resp, err
+		}
+		if !p.budget.withdraw() {
+			retryBudgetExhaustedTotal.WithLabelValues(p.route).Inc()
+			return resp, err
+		}
+
+		if resp != nil {
+			discard(resp)
+		}
+		if err := sleep(req.Context(), backoff(p.retry, attempt)); err != nil {
+			return nil, err
+		}
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		retriesTotal.WithLabelValues(p.route).Inc()
+	}
+}
+
+// attempt sends a request to an upstream, preferring ones not yet tried
+func (p *Pool) attempt(req *http.Request, tried map[*Upstream]bool) (*http.Response, error) {
+	upstream, err := p.pick(req, tried)
+	if err != nil {
+		return nil, err
+	}
+	tried[upstream] = true
+	return p.send(req, upstream)
+}
+
+// pick chooses a healthy upstream whose circuit breaker allows the request.
+// Upstreams in tried are skipped unless no other upstream is available.
+func (p *Pool) pick(req *http.Request, tried map[*Upstream]bool) (*Upstream, error) {
+	candidates := p.available()
+	if len(candidates) == 0 {
+		return nil, ErrNoUpstream
+	}
+
+	untried := make([]*Upstream, 0, len(candidates))
+	for _, upstream := range candidates {
+		if !tried[upstream] {
+			untried = append(untried, upstream)
+		}
+	}
+	if len(untried) > 0 {
+		candidates = untried
+	}
+
+	for len(candidates) > 0 {
+		upstream := p.balancer.Next(req, candidates)
+		if upstream.breaker.Allow() {
+			return upstream, nil
+		}
+		candidates = without(candidates, upstream)
+	}
+	return nil, ErrCircuitOpen
+}
+
+// without returns a copy of upstreams with one upstream removed
+func without(upstreams []*Upstream, removed *Upstream) []*Upstream {
+	remaining := make([]*Upstream, 0, len(upstreams)-1)
+	for _, upstream := range upstreams {
+		if upstream != removed {
+			remaining = append(remaining, upstream)
+		}
+	}
+	return remaining
+}
+
+// available returns the upstreams currently in rotation
+func (p *Pool) available() []*Upstream {
+	available := make([]*Upstream, 0, len(p.upstreams))
+	for _, upstream := range p.upstreams {
+		if upstream.Healthy() && !upstream.Drained() {
+			available = append(available, upstream)
+		}
+	}
+	return available
+}
+
+// send forwards a request to a specific upstream
+func (p *Pool) send(req *http.Request, upstream *Upstream) (*http.Response, error) {
+	ctx, timedOut, release := attemptContext(req.Context(), p.timeouts)
+	out := req.Clone(ctx)
+	out.URL.Scheme = upstream.URL.Scheme
+	out.URL.Host = upstream.URL.Host
+	out.URL.Path, out.URL.RawPath = joinURLPath(upstream.URL, req.URL)
+	if upstream.URL.RawQuery != "" {
+		if out.URL.RawQuery == "" {
+			out.URL.RawQuery = upstream.URL.RawQuery
+		} else {
+			out.URL.RawQuery = upstream.URL.RawQuery + "&" + out.URL.RawQuery
+		}
+	}
+	if p.streaming && IsStream(req) {
+		// Streams stay open while traffic flows, so there is no deadline to pass on
+		out.Header.Del(shared.DeadlineHeader)
+	} else {
+		setDeadlineHeader(out, p.timeouts.Response)
+	}
+
+	upstream.begin()
+	start := time.Now()
+	resp, err := p.transport.RoundTrip(out)
+	if timedOut() {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		resp, err = nil, ErrResponseTimeout
+	}
+	if err != nil {
+		release()
+		upstream.breaker.Record(true, time.Since(start))
+		upstream.end("error", true)
+		return nil, err
+	}
+
+	status := strconv.Itoa(resp.StatusCode)
+	failed := isUnavailableStatus(resp.StatusCode)
+	upstream.breaker.Record(upstream.breaker.isFailureStatus(resp.StatusCode), time.Since(start))
+	resp.Body = trackBody(resp.Body, func() {
+		release()
+		upstream.end(status, failed)
+	})
+	return resp, nil
+}
+
+// isUnavailableStatus reports whether a status code means the upstream
+// itself could not serve the request, as opposed to an application error
+func isUnavailableStatus(code int) bool {
+	return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+}
+
+// joinURLPath joins the upstream base path with the request path
+func joinURLPath(base, reqURL *url.URL) (path, rawPath string) {
+	if base.RawPath == "" && reqURL.RawPath == "" {
+		return singleJoiningSlash(base.Path, reqURL.Path), ""
+	}
+	// Same as singleJoiningSlash, but uses EscapedPath to determine whether a slash should be added
+	basePath := base.EscapedPath()
+	reqPath := reqURL.EscapedPath()
+	return singleJoiningSlash(base.Path, reqURL.Path), singleJoiningSlash(basePath, reqPath)
+}
+
+// singleJoiningSlash joins two path segments with exactly one slash
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
+
+// trackBody wraps a response body so done runs exactly once when it is closed.
+// Bodies of upgraded connections stay writable.
+func trackBody(body io.ReadCloser, done func()) io.ReadCloser {
+	tracked := &trackedBody{ReadCloser: body, done: done}
+	if rw, ok := body.(io.ReadWriteCloser); ok {
+		return &trackedReadWriteBody{trackedBody: tracked, writer: rw}
+	}
+	return tracked
+}
+
+type trackedBody struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (b *trackedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}
+
+type trackedReadWriteBody struct {
+	*trackedBody
+	writer io.Writer
+}
+
+func (b *trackedReadWriteBody) Write(p []byte) (int, error) {
+	return b.writer.Write(p)
+}
@@ -0,0 +1,210 @@
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"go-inventory-system/shared"
+)
+
+// Retry defaults
+const (
+	defaultRetryBackoff      = 25 * time.Millisecond
+	defaultRetryMaxBackoff   = 250 * time.Millisecond
+	defaultRetryMaxBodyBytes = 64 << 10
+
+	// maxDrainBytes is how much of a discarded response is read so the
+	// connection can be reused
+	maxDrainBytes = 4 << 10
+
+	// maxRetryBalance caps the retries a budget can save up during quiet periods
+	maxRetryBalance = 100
+)
+
+// defaultRetryOn are the status codes retried when a policy lists none
+var defaultRetryOn = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+// idempotentMethods can be safely sent more than once
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+// withRetryDefaults fills in unset retry policy fields
+func withRetryDefaults(policy shared.RetryPolicy) shared.RetryPolicy {
+	if len(policy.RetryOn) == 0 {
+		policy.RetryOn = defaultRetryOn
+	}
+	if policy.Backoff == 0 {
+		policy.Backoff = defaultRetryBackoff
+	}
+	if policy.MaxBackoff == 0 {
+		policy.MaxBackoff = defaultRetryMaxBackoff
+	}
+	if policy.MaxBodyBytes == 0 {
+		policy.MaxBodyBytes = defaultRetryMaxBodyBytes
+	}
+	return policy
+}
+
+// RetryBudget limits retries across all routes to a fraction of requests, so
+// that a failing backend is not hit by a retry storm. Every request deposits
+// Ratio of a retry into the budget and every retry withdraws one. A small
+// number of retries per second is always allowed so that low-traffic routes
+// can still retry.
+type RetryBudget struct {
+	mu           sync.Mutex
+	ratio        float64
+	minPerSecond float64
+	balance      float64
+	reserve      float64
+	lastRefill   time.Time
+}
+
+// NewRetryBudget creates a retry budget allowing ratio retries per request
+// plus minPerSecond retries per second
+func NewRetryBudget(ratio float64, minPerSecond int) *RetryBudget {
+	return &RetryBudget{
+		ratio:        ratio,
+		minPerSecond: float64(minPerSecond),
+		reserve:      float64(minPerSecond),
+		lastRefill:   time.Now(),
+	}
+}
+
+// deposit records a request, earning a fraction of a retry
+func (b *RetryBudget) deposit() {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.balance += b.ratio
+	if b.balance > maxRetryBalance {
+		b.balance = maxRetryBalance
+	}
+}
+
+// withdraw reports whether a retry is allowed, and spends it if so
+func (b *RetryBudget) withdraw() bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.reserve += now.Sub(b.lastRefill).Seconds() * b.minPerSecond
+	if b.reserve > b.minPerSecond {
+		b.reserve = b.minPerSecond
+	}
+	b.lastRefill = now
+
+	if b.reserve >= 1 {
+		b.reserve--
+		return true
+	}
+	if b.balance >= 1 {
+		b.balance--
+		return true
+	}
+	return false
+}
+
+// isRetryable reports whether a request may be sent more than once
+func isRetryable(req *http.Request) bool {
+	if req.Header.Get("Upgrade") != "" {
+		return false
+	}
+	return idempotentMethods[req.Method] || req.Header.Get("Idempotency-Key") != ""
+}
+
+// bufferBody reads up to limit bytes of the request body so it can be
+// replayed. It returns false, leaving the body readable from the start, if
+// the body is larger than limit.
+func bufferBody(req *http.Request, limit int64) (bool, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return true, nil
+	}
+	if req.ContentLength > limit {
+		return false, nil
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(req.Body, limit+1))
+	if err != nil {
+		return false, err
+	}
+	if int64(len(buf)) > limit {
+		req.Body = readCloser{io.MultiReader(bytes.NewReader(buf), req.Body), req.Body}
+		return false, nil
+	}
+
+	req.Body.Close()
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf)), nil
+	}
+	req.Body, _ = req.GetBody()
+	return true, nil
+}
+
+// readCloser reads from one source and closes another
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// shouldRetry reports whether an attempt's outcome is worth retrying
+func shouldRetry(ctx context.Context, policy shared.RetryPolicy, resp *http.Response, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if err != nil {
+		return err != ErrNoUpstream && err != ErrCircuitOpen
+	}
+	for _, code := range policy.RetryOn {
+		if resp.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the delay before a retry using exponential backoff with full jitter
+func backoff(policy shared.RetryPolicy, retry int) time.Duration {
+	delay := policy.Backoff << (retry - 1)
+	if delay > policy.MaxBackoff || delay <= 0 {
+		delay = policy.MaxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// sleep waits for d or until ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// discard drains and closes a response that will be replaced by a retry
+func discard(resp *http.Response) {
+	io.CopyN(io.Discard, resp.Body, maxDrainBytes)
+	resp.Body.Close()
+}
@@ -0,0 +1,23 @@
+package upstream
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// IsStream reports whether a request opens a long-lived connection: a
+// protocol upgrade such as WebSocket, or a Server-Sent Events stream
+func IsStream(r *http.Request) bool {
+	if r.Header.Get("Upgrade") != "" {
+		return true
+	}
+	for _, value := range r.Header.Values("Accept") {
+		for _, accepted := range strings.Split(value, ",") {
+			if mediaType, _, _ := mime.ParseMediaType(accepted); mediaType == "text/event-stream" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-inventory-system/shared"
+)
+
+// ErrResponseTimeout is returned when an upstream does not send response
+// headers within the route's response timeout
+var ErrResponseTimeout = fmt.Errorf("upstream response timeout: %w", context.DeadlineExceeded)
+
+// connectTimeoutKey is the context key for a route's connect timeout
+type connectTimeoutKey struct{}
+
+// NewTransport creates a transport for upstream connections. Dials honour the
+// connect timeout of the route a request belongs to.
+func NewTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if timeout, ok := ctx.Value(connectTimeoutKey{}).(time.Duration); ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+	return transport
+}
+
+// attemptContext derives the context of a single attempt from the request
+// context. The returned stop function reports whether the response timeout
+// fired; release must be called once the response is no longer used.
+func attemptContext(ctx context.Context, timeouts shared.RouteTimeouts) (attemptCtx context.Context, stop func() bool, release func()) {
+	if timeouts.Connect > 0 {
+		ctx = context.WithValue(ctx, connectTimeoutKey{}, timeouts.Connect)
+	}
+	if timeouts.Response <= 0 {
+		return ctx, func() bool { return false }, func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	timer := time.AfterFunc(timeouts.Response, cancel)
+	return ctx, func() bool { return !timer.Stop() }, cancel
+}
+
+// setDeadlineHeader tells the upstream how long the gateway will wait for it,
+// replacing any value sent by the client
+func setDeadlineHeader(req *http.Request, responseTimeout time.Duration) {
+	remaining := responseTimeout
+	if deadline, ok := req.Context().Deadline(); ok {
+		if untilDeadline := time.Until(deadline); remaining <= 0 || untilDeadline < remaining {
+			remaining = untilDeadline
+		}
+	}
+
+	if remaining <= 0 {
+		req.Header.Del(shared.DeadlineHeader)
+		return
+	}
+	ms := (remaining + time.Millisecond - 1) / time.Millisecond
+	req.Header.Set(shared.DeadlineHeader, strconv.FormatInt(int64(ms), 10))
+}
@@ -0,0 +1,113 @@
+package upstream
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	"go-inventory-system/shared"
+)
+
+// Transports hands out the transports pools send requests with, so
+// connections to backends are reused across route reloads. Routes without
+// TLS settings share one transport; routes with TLS settings share one per
+// distinct setting.
+type Transports struct {
+	mu    sync.Mutex
+	plain *http.Transport
+	tls   map[shared.UpstreamTLS]*tlsTransport
+}
+
+// tlsTransport is a transport along with a digest of the files its TLS
+// settings were loaded from
+type tlsTransport struct {
+	transport *http.Transport
+	digest    [sha256.Size]byte
+}
+
+// NewTransports creates an empty set of transports
+func NewTransports() *Transports {
+	return &Transports{
+		plain: NewTransport(),
+		tls:   make(map[shared.UpstreamTLS]*tlsTransport),
+	}
+}
+
+// Get returns the transport for a route's upstream TLS settings. Their files
+// are read on every call, and a new transport replaces the old one if they
+// changed, so rotated certificates are picked up when routes are reloaded.
+func (t *Transports) Get(config shared.UpstreamTLS) (http.RoundTripper, error) {
+	if config == (shared.UpstreamTLS{}) {
+		return t.plain, nil
+	}
+
+	tlsConfig, digest, err := loadUpstreamTLS(config)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	current, ok := t.tls[config]
+	if ok && current.digest == digest {
+		return current.transport, nil
+	}
+	if ok {
+		// Requests in flight finish on their connections; idle ones are dropped
+		current.transport.CloseIdleConnections()
+	}
+
+	transport := NewTransport()
+	transport.TLSClientConfig = tlsConfig
+	t.tls[config] = &tlsTransport{transport: transport, digest: digest}
+	return transport, nil
+}
+
+// loadUpstreamTLS reads the files of a route's upstream TLS settings
+func loadUpstreamTLS(config shared.UpstreamTLS) (*tls.Config, [sha256.Size]byte, error) {
+	var digest [sha256.Size]byte
+	hash := sha256.New()
+	tlsConfig := &tls.Config{
+		ServerName: config.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if config.CAFile != "" {
+		caPEM, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, digest, fmt.Errorf("read CA file: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(caPEM) {
+			return nil, digest, fmt.Errorf("no certificates found in %s", config.CAFile)
+		}
+		tlsConfig.RootCAs = roots
+		hash.Write(caPEM)
+	}
+
+	if config.CertFile != "" {
+		certPEM, err := os.ReadFile(config.CertFile)
+		if err != nil {
+			return nil, digest, fmt.Errorf("read certificate file: %w", err)
+		}
+		keyPEM, err := os.ReadFile(config.KeyFile)
+		if err != nil {
+			return nil, digest, fmt.Errorf("read key file: %w", err)
+		}
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, digest, fmt.Errorf("load certificate %s: %w", config.CertFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+		hash.Write(certPEM)
+		hash.Write(keyPEM)
+	}
+
+	copy(digest[:], hash.Sum(nil))
+	return tlsConfig, digest, nil
+}
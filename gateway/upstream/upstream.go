@@ -0,0 +1,129 @@
+package upstream
+
+import (
+	"log"
+	"net/url"
+	"sync/atomic"
+
+	"go-inventory-system/shared"
+)
+
+// Upstream is a single backend instance of a route
+type Upstream struct {
+	URL    *url.URL
+	Weight int
+
+	route        string
+	healthConfig shared.HealthCheck
+	health       healthState
+	breaker      *Breaker
+	drained      atomic.Bool
+	removed      atomic.Bool
+	active       atomic.Int64
+	requests     atomic.Uint64
+	failures     atomic.Uint64
+
+	// currentWeight is the smooth weighted round-robin state, guarded by the weighted balancer
+	currentWeight int
+}
+
+// Stats is a snapshot of an upstream's connection stats
+type Stats struct {
+	URL               string `json:"url"`
+	Weight            int    `json:"weight"`
+	Healthy           bool   `json:"healthy"`
+	Drained           bool   `json:"drained"`
+	CircuitState      string `json:"circuit_state"`
+	ActiveConnections int64  `json:"active_connections"`
+	TotalRequests     uint64 `json:"total_requests"`
+	Failures          uint64 `json:"failures"`
+}
+
+// newUpstream creates a healthy upstream with a closed breaker, defaulting the weight to 1
+func newUpstream(route shared.Route, target *url.URL, weight int, healthConfig shared.HealthCheck) *Upstream {
+	if weight <= 0 {
+		weight = 1
+	}
+	upstream := &Upstream{
+		URL:          target,
+		Weight:       weight,
+		route:        route.ID(),
+		healthConfig: healthConfig,
+		breaker:      newBreaker(route.CircuitBreaker, route.ID(), target.String()),
+	}
+	upstream.health.healthy = true
+	upstreamHealthy.WithLabelValues(route.ID(), target.String()).Set(1)
+	return upstream
+}
+
+// ActiveConnections returns the number of requests currently in flight
+func (u *Upstream) ActiveConnections() int64 {
+	return u.active.Load()
+}
+
+// Drained reports whether the upstream was taken out of rotation by an operator
+func (u *Upstream) Drained() bool {
+	return u.drained.Load()
+}
+
+// SetDrained takes the upstream out of rotation, or puts it back. Requests
+// in flight are not interrupted.
+func (u *Upstream) SetDrained(drained bool) {
+	if u.drained.Swap(drained) != drained {
+		log.Printf("Upstream %s of route %s drained: %t", u.URL, u.route, drained)
+	}
+}
+
+// Stats returns a snapshot of the upstream's connection stats
+func (u *Upstream) Stats() Stats {
+	return Stats{
+		URL:               u.URL.String(),
+		Weight:            u.Weight,
+		Healthy:           u.Healthy(),
+		Drained:           u.Drained(),
+		CircuitState:      u.breaker.State().String(),
+		ActiveConnections: u.active.Load(),
+		TotalRequests:     u.requests.Load(),
+		Failures:          u.failures.Load(),
+	}
+}
+
+// Inherit takes over the state of prev, the upstream this one replaces after
+// a reload that kept it in its route, so ejected upstreams stay out of
+// rotation and open circuits stay open
+func (u *Upstream) Inherit(prev *Upstream) {
+	u.inheritHealth(prev)
+	u.breaker.inherit(prev.breaker)
+}
+
+// Remove deletes the upstream's gauges once a reload has dropped it from its
+// route. Requests still in flight finish without updating them.
+func (u *Upstream) Remove() {
+	u.removed.Store(true)
+	u.breaker.remove()
+	activeConnections.DeleteLabelValues(u.route, u.URL.String())
+	upstreamHealthy.DeleteLabelValues(u.route, u.URL.String())
+}
+
+// begin records the start of a request
+func (u *Upstream) begin() {
+	u.requests.Add(1)
+	u.setActive(u.active.Add(1))
+}
+
+// end records the end of a request
+func (u *Upstream) end(status string, failed bool) {
+	if failed {
+		u.failures.Add(1)
+	}
+	u.recordRequest(failed)
+	u.setActive(u.active.Add(-1))
+	upstreamRequestsTotal.WithLabelValues(u.route, u.URL.String(), status).Inc()
+}
+
+// setActive updates the active connections gauge unless the upstream was removed
+func (u *Upstream) setActive(active int64) {
+	if !u.removed.Load() {
+		activeConnections.WithLabelValues(u.route, u.URL.String()).Set(float64(active))
+	}
+}
@@ -0,0 +1,22 @@
+package upstream
+
+import (
+	"context"
+	"net/http"
+)
+
+// variantKey is the context key for the variant of a split route a request
+// was assigned to
+type variantKey struct{}
+
+// WithVariant returns a copy of r assigned to a variant of a split route
+func WithVariant(r *http.Request, name string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), variantKey{}, name))
+}
+
+// Variant returns the variant of a split route r was assigned to, or "" if
+// the route has no split
+func Variant(r *http.Request) string {
+	name, _ := r.Context().Value(variantKey{}).(string)
+	return name
+}
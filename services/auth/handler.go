@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"net/http"
 
 	"go-inventory-system/shared"
@@ -22,33 +21,33 @@ func NewAuthHandler(db *gorm.DB) *AuthHandler {
 // Register handles user registration
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		shared.WriteErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Method not allowed"))
 		return
 	}
 
 	var req shared.AuthRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		shared.WriteErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+	if err := shared.DecodeJSON(r, &req); err != nil {
+		shared.WriteDecodeError(w, r, err)
 		return
 	}
 
-	// Validate request
-	if req.Email == "" || req.Password == "" || req.Username == "" {
-		shared.WriteErrorResponse(w, http.StatusBadRequest, "Email, password, and username are required")
+	// Username is optional on login but required to register
+	if req.Username == "" {
+		shared.WriteError(w, r, shared.NewValidationError(shared.FieldError{Field: "username", Message: "is required"}))
 		return
 	}
 
 	// Check if user already exists
 	var existingUser shared.User
-	if err := h.db.Where("email = ? OR username = ?", req.Email, req.Username).First(&existingUser).Error; err == nil {
-		shared.WriteErrorResponse(w, http.StatusConflict, "User already exists")
+	if err := h.db.WithContext(r.Context()).Where("email = ? OR username = ?", req.Email, req.Username).First(&existingUser).Error; err == nil {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusConflict, shared.ErrCodeUserExists, "User already exists"))
 		return
 	}
 
 	// Hash password
 	hashedPassword, err := shared.HashPassword(req.Password)
 	if err != nil {
-		shared.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to process password")
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to process password"))
 		return
 	}
 
@@ -57,17 +56,18 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		Email:    req.Email,
 		Username: req.Username,
 		Password: hashedPassword,
+		Role:     shared.RoleUser,
 	}
 
-	if err := h.db.Create(&user).Error; err != nil {
-		shared.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to create user")
+	if err := h.db.WithContext(r.Context()).Create(&user).Error; err != nil {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to create user"))
 		return
 	}
 
 	// Generate JWT token
-	token, err := shared.GenerateJWT(user.ID, user.Email)
+	token, err := shared.GenerateJWT(user.ID, user.Email, user.Role)
 	if err != nil {
-		shared.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to generate token")
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to generate token"))
 		return
 	}
 
@@ -83,39 +83,33 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 // Login handles user login
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		shared.WriteErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Method not allowed"))
 		return
 	}
 
 	var req shared.AuthRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		shared.WriteErrorResponse(w, http.StatusBadRequest, "Invalid request body")
-		return
-	}
-
-	// Validate request
-	if req.Email == "" || req.Password == "" {
-		shared.WriteErrorResponse(w, http.StatusBadRequest, "Email and password are required")
+	if err := shared.DecodeJSON(r, &req); err != nil {
+		shared.WriteDecodeError(w, r, err)
 		return
 	}
 
 	// Find user
 	var user shared.User
-	if err := h.db.Where("email = ?", req.Email).First(&user).Error; err != nil {
-		shared.WriteErrorResponse(w, http.StatusUnauthorized, "Invalid credentials")
+	if err := h.db.WithContext(r.Context()).Where("email = ?", req.Email).First(&user).Error; err != nil {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusUnauthorized, shared.ErrCodeInvalidCredentials, "Invalid credentials"))
 		return
 	}
 
 	// Check password
 	if !shared.CheckPassword(req.Password, user.Password) {
-		shared.WriteErrorResponse(w, http.StatusUnauthorized, "Invalid credentials")
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusUnauthorized, shared.ErrCodeInvalidCredentials, "Invalid credentials"))
 		return
 	}
 
 	// Generate JWT token
-	token, err := shared.GenerateJWT(user.ID, user.Email)
+	token, err := shared.GenerateJWT(user.ID, user.Email, user.Role)
 	if err != nil {
-		shared.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to generate token")
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to generate token"))
 		return
 	}
 
@@ -22,13 +22,24 @@ func main() {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
-	// Initialize handler
+	// Initialize handlers
 	authHandler := NewAuthHandler(db)
 
+	oidcProvider, err := NewOIDCProvider(db, shared.LoadOIDCConfig())
+	if err != nil {
+		log.Fatalf("Failed to initialize OIDC provider: %v", err)
+	}
+
 	// Setup routes
 	mux := http.NewServeMux()
 	mux.HandleFunc("/auth/register", authHandler.Register)
 	mux.HandleFunc("/auth/login", authHandler.Login)
+	mux.HandleFunc("/auth/authorize", oidcProvider.Authorize)
+	mux.HandleFunc("/auth/token", oidcProvider.Token)
+	mux.HandleFunc("/auth/userinfo", oidcProvider.UserInfo)
+	mux.HandleFunc("/auth/jwks", oidcProvider.JWKS)
+	mux.HandleFunc("/auth/.well-known/openid-configuration", oidcProvider.Discovery)
+	mux.HandleFunc("/.well-known/openid-configuration", oidcProvider.Discovery)
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("Auth service is healthy"))
@@ -37,7 +48,7 @@ func main() {
 	// Create server
 	server := &http.Server{
 		Addr:         ":" + config.Port,
-		Handler:      mux,
+		Handler:      shared.DeadlineMiddleware(mux),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
@@ -46,7 +57,7 @@ func main() {
 	// Start server in a goroutine
 	go func() {
 		log.Printf("Auth service starting on port %s", config.Port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := shared.ListenAndServe(server, config); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Failed to start server: %v", err)
 		}
 	}()
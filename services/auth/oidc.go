@@ -0,0 +1,497 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"html/template"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-inventory-system/shared"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// authorizationCode holds the state of an issued authorization code
+type authorizationCode struct {
+	ClientID            string
+	RedirectURI         string
+	UserID              uint
+	Scope               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	AuthTime            time.Time
+	ExpiresAt           time.Time
+}
+
+// OIDCProvider implements a minimal OpenID Connect provider
+// supporting the authorization code flow with PKCE
+type OIDCProvider struct {
+	db         *gorm.DB
+	config     *shared.OIDCConfig
+	signingKey *rsa.PrivateKey
+	keyID      string
+
+	mu    sync.Mutex
+	codes map[string]*authorizationCode
+}
+
+// NewOIDCProvider creates a new OpenID Connect provider
+func NewOIDCProvider(db *gorm.DB, config *shared.OIDCConfig) (*OIDCProvider, error) {
+	key, err := loadSigningKey(config.SigningKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	thumbprint := sha256.Sum256(key.PublicKey.N.Bytes())
+
+	return &OIDCProvider{
+		db:         db,
+		config:     config,
+		signingKey: key,
+		keyID:      base64.RawURLEncoding.EncodeToString(thumbprint[:])[:16],
+		codes:      make(map[string]*authorizationCode),
+	}, nil
+}
+
+// loadSigningKey loads an RSA private key from a PEM file, or generates
+// an ephemeral one when no file is configured
+func loadSigningKey(filename string) (*rsa.PrivateKey, error) {
+	if filename == "" {
+		log.Println("OIDC_SIGNING_KEY_FILE not set, generating ephemeral signing key")
+		return rsa.GenerateKey(rand.Reader, 2048)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found in signing key file")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("signing key is not an RSA key")
+	}
+	return key, nil
+}
+
+// Discovery serves the OpenID Connect discovery document
+func (p *OIDCProvider) Discovery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Method not allowed"))
+		return
+	}
+
+	issuer := p.config.Issuer
+	shared.WriteJSONResponse(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/authorize",
+		"token_endpoint":                        issuer + "/token",
+		"userinfo_endpoint":                     issuer + "/userinfo",
+		"jwks_uri":                              issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      []string{"openid", "email", "profile"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported":                      []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "email", "preferred_username"},
+	})
+}
+
+// JWKS serves the public keys used to sign ID tokens
+func (p *OIDCProvider) JWKS(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Method not allowed"))
+		return
+	}
+
+	pub := p.signingKey.PublicKey
+	shared.WriteJSONResponse(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": p.keyID,
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+// Authorize handles the authorization endpoint. GET renders the login form,
+// POST checks the submitted credentials and redirects back with a code.
+func (p *OIDCProvider) Authorize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Method not allowed"))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusBadRequest, shared.ErrCodeBadRequest, "Invalid request"))
+		return
+	}
+
+	// Client and redirect URI must be checked before anything is sent back to the redirect URI
+	clientID := r.Form.Get("client_id")
+	redirectURI := r.Form.Get("redirect_uri")
+	if clientID != p.config.ClientID {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusBadRequest, shared.ErrCodeUnknownClient, "Unknown client"))
+		return
+	}
+	if !p.isRedirectURIAllowed(redirectURI) {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusBadRequest, shared.ErrCodeInvalidRedirectURI, "Invalid redirect URI"))
+		return
+	}
+
+	state := r.Form.Get("state")
+	if r.Form.Get("response_type") != "code" {
+		redirectWithError(w, r, redirectURI, state, "unsupported_response_type", "Only the code response type is supported")
+		return
+	}
+	if !hasScope(r.Form.Get("scope"), "openid") {
+		redirectWithError(w, r, redirectURI, state, "invalid_scope", "The openid scope is required")
+		return
+	}
+	if r.Form.Get("code_challenge") == "" || r.Form.Get("code_challenge_method") != "S256" {
+		redirectWithError(w, r, redirectURI, state, "invalid_request", "PKCE with S256 is required")
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		renderLoginForm(w, http.StatusOK, r.Form, "")
+		return
+	}
+
+	// Authenticate the user against the existing user store
+	var user shared.User
+	if err := p.db.WithContext(r.Context()).Where("email = ?", r.Form.Get("email")).First(&user).Error; err != nil ||
+		!shared.CheckPassword(r.Form.Get("password"), user.Password) {
+		renderLoginForm(w, http.StatusUnauthorized, r.Form, "Invalid credentials")
+		return
+	}
+
+	code, err := shared.GenerateRandomString(32)
+	if err != nil {
+		redirectWithError(w, r, redirectURI, state, "server_error", "Failed to issue authorization code")
+		return
+	}
+
+	p.mu.Lock()
+	p.purgeExpiredCodes()
+	p.codes[code] = &authorizationCode{
+		ClientID:            clientID,
+		RedirectURI:         redirectURI,
+		UserID:              user.ID,
+		Scope:               r.Form.Get("scope"),
+		Nonce:               r.Form.Get("nonce"),
+		CodeChallenge:       r.Form.Get("code_challenge"),
+		CodeChallengeMethod: r.Form.Get("code_challenge_method"),
+		AuthTime:            time.Now(),
+		ExpiresAt:           time.Now().Add(p.config.CodeTTL),
+	}
+	p.mu.Unlock()
+
+	query := url.Values{"code": {code}}
+	if state != "" {
+		query.Set("state", state)
+	}
+	http.Redirect(w, r, appendQuery(redirectURI, query), http.StatusFound)
+}
+
+// Token exchanges an authorization code for an access token and ID token
+func (p *OIDCProvider) Token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Method not allowed"))
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Invalid request body")
+		return
+	}
+
+	clientID, ok := p.authenticateClient(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+		return
+	}
+
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "Only authorization_code is supported")
+		return
+	}
+
+	// Codes are single use, so remove it whether or not the exchange succeeds
+	code := r.PostForm.Get("code")
+	p.mu.Lock()
+	authCode, found := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+
+	if !found || time.Now().After(authCode.ExpiresAt) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid or expired authorization code")
+		return
+	}
+	if authCode.ClientID != clientID {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Authorization code was issued to another client")
+		return
+	}
+	if authCode.RedirectURI != r.PostForm.Get("redirect_uri") {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Redirect URI mismatch")
+		return
+	}
+	if !verifyCodeChallenge(authCode.CodeChallenge, r.PostForm.Get("code_verifier")) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid code verifier")
+		return
+	}
+
+	var user shared.User
+	if err := p.db.WithContext(r.Context()).First(&user, authCode.UserID).Error; err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "User no longer exists")
+		return
+	}
+
+	accessToken, err := shared.GenerateJWT(user.ID, user.Email, user.Role)
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "Failed to generate token")
+		return
+	}
+
+	idToken, err := p.generateIDToken(&user, authCode)
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "Failed to generate ID token")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	shared.WriteJSONResponse(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(shared.JWTExpiry.Seconds()),
+		"id_token":     idToken,
+		"scope":        authCode.Scope,
+	})
+}
+
+// UserInfo returns claims about the user identified by the access token
+func (p *OIDCProvider) UserInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Method not allowed"))
+		return
+	}
+
+	token, err := shared.ExtractTokenFromHeader(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusUnauthorized, shared.ErrCodeUnauthorized, "Invalid or missing token"))
+		return
+	}
+
+	claims, err := shared.ValidateJWT(token)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusUnauthorized, shared.ErrCodeInvalidToken, "Invalid token"))
+		return
+	}
+
+	var user shared.User
+	if err := p.db.WithContext(r.Context()).First(&user, claims.UserID).Error; err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusUnauthorized, shared.ErrCodeInvalidToken, "Invalid token"))
+		return
+	}
+
+	shared.WriteJSONResponse(w, http.StatusOK, map[string]interface{}{
+		"sub":                strconv.FormatUint(uint64(user.ID), 10),
+		"email":              user.Email,
+		"preferred_username": user.Username,
+	})
+}
+
+// purgeExpiredCodes drops codes that were never exchanged. Callers must hold p.mu.
+func (p *OIDCProvider) purgeExpiredCodes() {
+	now := time.Now()
+	for code, authCode := range p.codes {
+		if now.After(authCode.ExpiresAt) {
+			delete(p.codes, code)
+		}
+	}
+}
+
+// generateIDToken signs an ID token for the user of an authorization code
+func (p *OIDCProvider) generateIDToken(user *shared.User, authCode *authorizationCode) (string, error) {
+	now := time.Now()
+	claims := shared.IDTokenClaims{
+		UserClaims: shared.UserClaims{
+			UserID: user.ID,
+			Email:  user.Email,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    p.config.Issuer,
+				Subject:   strconv.FormatUint(uint64(user.ID), 10),
+				Audience:  jwt.ClaimStrings{authCode.ClientID},
+				ExpiresAt: jwt.NewNumericDate(now.Add(shared.JWTExpiry)),
+				IssuedAt:  jwt.NewNumericDate(now),
+				NotBefore: jwt.NewNumericDate(now),
+			},
+		},
+		Nonce:             authCode.Nonce,
+		PreferredUsername: user.Username,
+		AuthTime:          jwt.NewNumericDate(authCode.AuthTime),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = p.keyID
+	return token.SignedString(p.signingKey)
+}
+
+// authenticateClient checks client credentials sent via HTTP Basic or the request body
+// and returns the authenticated client ID. Clients without a configured secret are
+// treated as public clients.
+func (p *OIDCProvider) authenticateClient(r *http.Request) (string, bool) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		// Basic credentials are form-urlencoded (RFC 6749 section 2.3.1)
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		clientSecret = r.PostForm.Get("client_secret")
+	}
+
+	if clientID != p.config.ClientID {
+		return "", false
+	}
+	if p.config.ClientSecret == "" {
+		return clientID, true
+	}
+	return clientID, subtle.ConstantTimeCompare([]byte(clientSecret), []byte(p.config.ClientSecret)) == 1
+}
+
+// isRedirectURIAllowed checks a redirect URI against the registered ones
+func (p *OIDCProvider) isRedirectURIAllowed(redirectURI string) bool {
+	for _, allowed := range p.config.RedirectURIs {
+		if redirectURI == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyCodeChallenge checks a PKCE code verifier against its S256 challenge
+func verifyCodeChallenge(challenge, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// hasScope checks if a space-separated scope string contains a scope
+func hasScope(scope, want string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == want {
+			return true
+		}
+	}
+	return false
+}
+
+// appendQuery adds query parameters to a URL that may already have some
+func appendQuery(rawURL string, query url.Values) string {
+	if strings.Contains(rawURL, "?") {
+		return rawURL + "&" + query.Encode()
+	}
+	return rawURL + "?" + query.Encode()
+}
+
+// redirectWithError sends an OAuth error back to the client's redirect URI
+func redirectWithError(w http.ResponseWriter, r *http.Request, redirectURI, state, code, description string) {
+	query := url.Values{"error": {code}, "error_description": {description}}
+	if state != "" {
+		query.Set("state", state)
+	}
+	http.Redirect(w, r, appendQuery(redirectURI, query), http.StatusFound)
+}
+
+// writeOAuthError writes an error response as defined by RFC 6749 section 5.2
+func writeOAuthError(w http.ResponseWriter, statusCode int, code, description string) {
+	w.Header().Set("Cache-Control", "no-store")
+	shared.WriteJSONResponse(w, statusCode, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+var loginForm = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Sign in</title></head>
+<body>
+  <h1>Sign in</h1>
+  {{if .Error}}<p style="color:red">{{.Error}}</p>{{end}}
+  <form method="POST">
+    {{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+    {{end}}
+    <label>Email <input type="email" name="email" required></label><br>
+    <label>Password <input type="password" name="password" required></label><br>
+    <button type="submit">Sign in</button>
+  </form>
+</body>
+</html>
+`))
+
+// authorizeParams are the authorization request parameters carried through the login form
+var authorizeParams = []string{
+	"response_type", "client_id", "redirect_uri", "scope", "state",
+	"nonce", "code_challenge", "code_challenge_method",
+}
+
+// renderLoginForm renders the login form, preserving the authorization request
+func renderLoginForm(w http.ResponseWriter, statusCode int, form url.Values, message string) {
+	params := make(map[string]string)
+	for _, name := range authorizeParams {
+		if value := form.Get(name); value != "" {
+			params[name] = value
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	loginForm.Execute(w, struct {
+		Params map[string]string
+		Error  string
+	}{params, message})
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go-inventory-system/shared"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID    = "admin-dashboard"
+	testRedirectURI = "http://localhost:3000/callback"
+	testEmail       = "alice@example.com"
+	testPassword    = "correct horse battery staple"
+	testVerifier    = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk-test-verifier"
+)
+
+// newTestProvider creates a provider backed by a temporary database holding one user
+func newTestProvider(t *testing.T) (*OIDCProvider, *shared.User) {
+	t.Helper()
+
+	db, err := initDatabase(filepath.Join(t.TempDir(), "auth.db"))
+	if err != nil {
+		t.Fatalf("init database: %v", err)
+	}
+	hash, err := shared.HashPassword(testPassword)
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	user := &shared.User{Email: testEmail, Username: "alice", Password: hash}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	provider, err := NewOIDCProvider(db, &shared.OIDCConfig{
+		Issuer:       "http://localhost:8000/auth",
+		ClientID:     testClientID,
+		RedirectURIs: []string{testRedirectURI},
+		CodeTTL:      time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("new provider: %v", err)
+	}
+	return provider, user
+}
+
+// codeChallenge returns the S256 challenge of a verifier
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// postForm calls a handler with a form-encoded POST request
+func postForm(handler http.HandlerFunc, target string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+// authorize signs the test user in and returns the issued code
+func authorize(t *testing.T, provider *OIDCProvider) string {
+	t.Helper()
+
+	rec := postForm(provider.Authorize, "/auth/authorize", url.Values{
+		"response_type":         {"code"},
+		"client_id":             {testClientID},
+		"redirect_uri":          {testRedirectURI},
+		"scope":                 {"openid email"},
+		"state":                 {"xyz"},
+		"nonce":                 {"n-0S6_WzA2Mj"},
+		"code_challenge":        {codeChallenge(testVerifier)},
+		"code_challenge_method": {"S256"},
+		"email":                 {testEmail},
+		"password":              {testPassword},
+	})
+	if rec.Code != http.StatusFound {
+		t.Fatalf("authorize: status %d, body %s", rec.Code, rec.Body.String())
+	}
+
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("authorize: invalid redirect: %v", err)
+	}
+	if got := location.Scheme + "://" + location.Host + location.Path; got != testRedirectURI {
+		t.Fatalf("authorize: redirected to %s, want %s", got, testRedirectURI)
+	}
+	if state := location.Query().Get("state"); state != "xyz" {
+		t.Fatalf("authorize: state %q, want %q", state, "xyz")
+	}
+	code := location.Query().Get("code")
+	if code == "" {
+		t.Fatalf("authorize: no code in %s", location)
+	}
+	return code
+}
+
+// exchange redeems a code at the token endpoint
+func exchange(provider *OIDCProvider, code, verifier string) *httptest.ResponseRecorder {
+	return postForm(provider.Token, "/auth/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {testRedirectURI},
+		"client_id":     {testClientID},
+		"code_verifier": {verifier},
+	})
+}
+
+// fetchJWKS returns the signing keys published by the provider by key ID
+func fetchJWKS(t *testing.T, provider *OIDCProvider) map[string]*rsa.PublicKey {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	provider.JWKS(rec, httptest.NewRequest(http.MethodGet, "/auth/jwks", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("jwks: status %d", rec.Code)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty, Alg, Kid, N, E string
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &set); err != nil {
+		t.Fatalf("jwks: %v", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, key := range set.Keys {
+		if key.Kty != "RSA" || key.Alg != "RS256" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			t.Fatalf("jwks: modulus: %v", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			t.Fatalf("jwks: exponent: %v", err)
+		}
+		keys[key.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	return keys
+}
+
+func TestAuthorizationCodeFlowWithPKCE(t *testing.T) {
+	provider, user := newTestProvider(t)
+
+	code := authorize(t, provider)
+
+	rec := exchange(provider, code, testVerifier)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("token: status %d, body %s", rec.Code, rec.Body.String())
+	}
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		IDToken     string `json:"id_token"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &tokens); err != nil {
+		t.Fatalf("token: %v", err)
+	}
+	if tokens.TokenType != "Bearer" || tokens.AccessToken == "" || tokens.IDToken == "" {
+		t.Fatalf("token: unexpected response %s", rec.Body.String())
+	}
+
+	keys := fetchJWKS(t, provider)
+	claims := &shared.IDTokenClaims{}
+	_, err := jwt.ParseWithClaims(tokens.IDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := keys[kid]
+		if !ok {
+			return nil, errors.New("unknown key ID " + kid)
+		}
+		return key, nil
+	},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer("http://localhost:8000/auth"),
+		jwt.WithAudience(testClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		t.Fatalf("id token: %v", err)
+	}
+	if want := strconv.FormatUint(uint64(user.ID), 10); claims.Subject != want {
+		t.Errorf("id token: subject %q, want %q", claims.Subject, want)
+	}
+	if claims.Nonce != "n-0S6_WzA2Mj" {
+		t.Errorf("id token: nonce %q, want %q", claims.Nonce, "n-0S6_WzA2Mj")
+	}
+	if claims.Email != testEmail {
+		t.Errorf("id token: email %q, want %q", claims.Email, testEmail)
+	}
+
+	// Codes are single use
+	if rec := exchange(provider, code, testVerifier); rec.Code != http.StatusBadRequest {
+		t.Errorf("second exchange: status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+}
+
+func TestTokenRejectsInvalidGrants(t *testing.T) {
+	tests := []struct {
+		name     string
+		verifier string
+		clientID string // client the code was issued to
+	}{
+		{name: "wrong verifier", verifier: strings.Repeat("a", 43), clientID: testClientID},
+		{name: "missing verifier", verifier: "", clientID: testClientID},
+		{name: "code of another client", verifier: testVerifier, clientID: "other-client"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, _ := newTestProvider(t)
+			code := authorize(t, provider)
+			provider.codes[code].ClientID = tt.clientID
+
+			rec := exchange(provider, code, tt.verifier)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+			var body struct {
+				Error string `json:"error"`
+			}
+			json.Unmarshal(rec.Body.Bytes(), &body)
+			if body.Error != "invalid_grant" {
+				t.Errorf("error %q, want %q", body.Error, "invalid_grant")
+			}
+		})
+	}
+}
@@ -16,8 +16,8 @@ func initDatabase(databaseURL string) (*gorm.DB, error) {
 		return nil, err
 	}
 
-	// Auto migrate the Order model
-	if err := db.AutoMigrate(&shared.Order{}); err != nil {
+	// Auto migrate the Order and OrderEvent models
+	if err := db.AutoMigrate(&shared.Order{}, &shared.OrderEvent{}); err != nil {
 		return nil, err
 	}
 
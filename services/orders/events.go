@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-inventory-system/shared"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// heartbeatInterval keeps idle streams open through the gateway
+	heartbeatInterval = 20 * time.Second
+
+	// subscriptionBuffer is how many events a stream may fall behind before
+	// it is closed; the client then resumes from the database
+	subscriptionBuffer = 32
+
+	// replayBatchSize bounds the events loaded at once when a stream resumes
+	replayBatchSize = 500
+
+	// reconnectDelay is the delay clients wait before reconnecting, in milliseconds
+	reconnectDelay = 3000
+)
+
+// eventHub fans out order events to the streams subscribed to them
+type eventHub struct {
+	mu            sync.Mutex
+	subscriptions map[*subscription]struct{}
+	closed        bool
+}
+
+// subscription receives the events of one user's orders, or of one order
+type subscription struct {
+	userID  uint
+	orderID uint // 0 for all of the user's orders
+	events  chan shared.OrderEvent
+}
+
+// newEventHub creates a hub without subscriptions
+func newEventHub() *eventHub {
+	return &eventHub{subscriptions: make(map[*subscription]struct{})}
+}
+
+// subscribe starts receiving events. The events channel is closed when the
+// subscription falls behind or the hub is closed.
+func (h *eventHub) subscribe(userID, orderID uint) *subscription {
+	sub := &subscription{
+		userID:  userID,
+		orderID: orderID,
+		events:  make(chan shared.OrderEvent, subscriptionBuffer),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(sub.events)
+		return sub
+	}
+	h.subscriptions[sub] = struct{}{}
+	return sub
+}
+
+// unsubscribe stops a subscription
+func (h *eventHub) unsubscribe(sub *subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subscriptions[sub]; ok {
+		delete(h.subscriptions, sub)
+		close(sub.events)
+	}
+}
+
+// publish sends an event to the matching subscriptions without blocking.
+// Subscriptions that cannot keep up are closed.
+func (h *eventHub) publish(event shared.OrderEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subscriptions {
+		if sub.userID != event.UserID || (sub.orderID != 0 && sub.orderID != event.OrderID) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			delete(h.subscriptions, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// close ends all subscriptions, for example on shutdown
+func (h *eventHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for sub := range h.subscriptions {
+		delete(h.subscriptions, sub)
+		close(sub.events)
+	}
+}
+
+// recordStatus stores a status change of an order
+func recordStatus(tx *gorm.DB, orderID, userID uint, status string) (shared.OrderEvent, error) {
+	event := shared.OrderEvent{OrderID: orderID, UserID: userID, Status: status}
+	err := tx.Create(&event).Error
+	return event, err
+}
+
+// HandleOrderEvents handles the /orders/events endpoint, streaming status
+// changes of all of the caller's orders
+func (h *OrderHandler) HandleOrderEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Method not allowed"))
+		return
+	}
+	h.StreamOrderEvents(w, r, 0)
+}
+
+// StreamOrderEvents streams status changes as Server-Sent Events, for one
+// order or, with orderID 0, for all of the caller's orders. A client that
+// sends Last-Event-ID first receives the events it missed. A new stream of
+// one order starts with the order's current status.
+func (h *OrderHandler) StreamOrderEvents(w http.ResponseWriter, r *http.Request, orderID uint) {
+	claims, err := shared.AuthenticateRequest(r)
+	if err != nil {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusUnauthorized, shared.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+	userID := claims.UserID
+
+	lastID, resuming, err := lastEventID(r)
+	if err != nil {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusBadRequest, shared.ErrCodeBadRequest, "Invalid Last-Event-ID"))
+		return
+	}
+
+	// Subscribe before reading the database so no event falls in between;
+	// events seen in both are skipped by ID
+	sub := h.events.subscribe(userID, orderID)
+	defer h.events.unsubscribe(sub)
+
+	db := h.db.WithContext(r.Context())
+	var snapshot *shared.OrderEvent
+	if !resuming {
+		// Start after everything that has happened so far
+		if err := db.Model(&shared.OrderEvent{}).Select("COALESCE(MAX(id), 0)").Scan(&lastID).Error; err != nil {
+			shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to fetch order events"))
+			return
+		}
+	}
+	if orderID != 0 {
+		var order shared.Order
+		if err := db.First(&order, orderID).Error; err != nil || order.UserID != userID {
+			if err == nil || err == gorm.ErrRecordNotFound {
+				// Other users' orders are reported as missing
+				shared.WriteError(w, r, shared.NewAPIError(http.StatusNotFound, shared.ErrCodeOrderNotFound, "Order not found"))
+			} else {
+				shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to fetch order"))
+			}
+			return
+		}
+		if !resuming {
+			snapshot = &shared.OrderEvent{ID: lastID, OrderID: order.ID, UserID: order.UserID, Status: order.Status, CreatedAt: order.UpdatedAt}
+		}
+	}
+
+	// Streams outlive the server's read and write timeouts
+	controller := http.NewResponseController(w)
+	controller.SetReadDeadline(time.Time{})
+	controller.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n", reconnectDelay)
+	if snapshot != nil {
+		err = writeEvent(w, *snapshot)
+	} else {
+		// An ID without data moves the client's resume point without an event
+		_, err = fmt.Fprintf(w, "id: %d\n\n", lastID)
+	}
+	if err != nil || controller.Flush() != nil {
+		return
+	}
+
+	// Replay events stored since the resume point
+	for {
+		var events []shared.OrderEvent
+		query := db.Where("id > ? AND user_id = ?", lastID, userID)
+		if orderID != 0 {
+			query = query.Where("order_id = ?", orderID)
+		}
+		if err := query.Order("id").Limit(replayBatchSize).Find(&events).Error; err != nil {
+			return
+		}
+		for _, event := range events {
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+			lastID = event.ID
+		}
+		if controller.Flush() != nil {
+			return
+		}
+		if len(events) < replayBatchSize {
+			break
+		}
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.events:
+			if !ok {
+				// Fell behind or shutting down; the client resumes from lastID
+				return
+			}
+			if event.ID <= lastID {
+				continue
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+			lastID = event.ID
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		if controller.Flush() != nil {
+			return
+		}
+	}
+}
+
+// writeEvent writes an order event in Server-Sent Events format
+func writeEvent(w io.Writer, event shared.OrderEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: status\ndata: %s\n\n", event.ID, data)
+	return err
+}
+
+// lastEventID returns the ID a client resumes after, from the Last-Event-ID
+// header or, for the first connection, the last_event_id query parameter
+func lastEventID(r *http.Request) (id uint, ok bool, err error) {
+	value := strings.TrimSpace(r.Header.Get("Last-Event-ID"))
+	if value == "" {
+		value = r.URL.Query().Get("last_event_id")
+	}
+	if value == "" {
+		return 0, false, nil
+	}
+
+	parsed, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0, false, err
+	}
+	return uint(parsed), true, nil
+}
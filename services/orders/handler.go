@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"net/http"
 	"strconv"
 	"strings"
@@ -13,12 +12,18 @@ import (
 
 // OrderHandler handles order-related requests
 type OrderHandler struct {
-	db *gorm.DB
+	db     *gorm.DB
+	events *eventHub
 }
 
 // NewOrderHandler creates a new order handler
 func NewOrderHandler(db *gorm.DB) *OrderHandler {
-	return &OrderHandler{db: db}
+	return &OrderHandler{db: db, events: newEventHub()}
+}
+
+// Close ends the order handler's event streams
+func (h *OrderHandler) Close() {
+	h.events.close()
 }
 
 // HandleOrders handles /orders endpoint (GET, POST)
@@ -29,22 +34,36 @@ func (h *OrderHandler) HandleOrders(w http.ResponseWriter, r *http.Request) {
 	case http.MethodPost:
 		h.CreateOrder(w, r)
 	default:
-		shared.WriteErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Method not allowed"))
 	}
 }
 
-// HandleOrder handles /orders/{id} endpoint (GET, PUT, DELETE)
+// HandleOrder handles /orders/{id} endpoint (GET, PUT, PATCH, DELETE) and
+// the order's status stream at /orders/{id}/events
 func (h *OrderHandler) HandleOrder(w http.ResponseWriter, r *http.Request) {
 	// Extract order ID from URL
 	pathParts := strings.Split(r.URL.Path, "/")
 	if len(pathParts) < 3 {
-		shared.WriteErrorResponse(w, http.StatusBadRequest, "Invalid order ID")
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusBadRequest, shared.ErrCodeBadRequest, "Invalid order ID"))
 		return
 	}
 
 	orderID, err := strconv.ParseUint(pathParts[2], 10, 32)
 	if err != nil {
-		shared.WriteErrorResponse(w, http.StatusBadRequest, "Invalid order ID")
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusBadRequest, shared.ErrCodeBadRequest, "Invalid order ID"))
+		return
+	}
+
+	if len(pathParts) > 3 {
+		if len(pathParts) != 4 || pathParts[3] != "events" {
+			shared.WriteError(w, r, shared.NewAPIError(http.StatusNotFound, shared.ErrCodeNotFound, "Not found"))
+			return
+		}
+		if r.Method != http.MethodGet {
+			shared.WriteError(w, r, shared.NewAPIError(http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Method not allowed"))
+			return
+		}
+		h.StreamOrderEvents(w, r, uint(orderID))
 		return
 	}
 
@@ -53,36 +72,38 @@ func (h *OrderHandler) HandleOrder(w http.ResponseWriter, r *http.Request) {
 		h.GetOrder(w, r, uint(orderID))
 	case http.MethodPut:
 		h.UpdateOrder(w, r, uint(orderID))
+	case http.MethodPatch:
+		h.PatchOrder(w, r, uint(orderID))
 	case http.MethodDelete:
 		h.DeleteOrder(w, r, uint(orderID))
 	default:
-		shared.WriteErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Method not allowed"))
 	}
 }
 
 // GetUserOrders handles /orders/user/{user_id} endpoint
 func (h *OrderHandler) GetUserOrders(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		shared.WriteErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Method not allowed"))
 		return
 	}
 
 	// Extract user ID from URL
 	pathParts := strings.Split(r.URL.Path, "/")
 	if len(pathParts) < 4 {
-		shared.WriteErrorResponse(w, http.StatusBadRequest, "Invalid user ID")
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusBadRequest, shared.ErrCodeBadRequest, "Invalid user ID"))
 		return
 	}
 
 	userID, err := strconv.ParseUint(pathParts[3], 10, 32)
 	if err != nil {
-		shared.WriteErrorResponse(w, http.StatusBadRequest, "Invalid user ID")
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusBadRequest, shared.ErrCodeBadRequest, "Invalid user ID"))
 		return
 	}
 
 	var orders []shared.Order
-	if err := h.db.Where("user_id = ?", userID).Find(&orders).Error; err != nil {
-		shared.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to fetch orders")
+	if err := h.db.WithContext(r.Context()).Where("user_id = ?", userID).Find(&orders).Error; err != nil {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to fetch orders"))
 		return
 	}
 
@@ -92,8 +113,8 @@ func (h *OrderHandler) GetUserOrders(w http.ResponseWriter, r *http.Request) {
 // ListOrders returns all orders
 func (h *OrderHandler) ListOrders(w http.ResponseWriter, r *http.Request) {
 	var orders []shared.Order
-	if err := h.db.Find(&orders).Error; err != nil {
-		shared.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to fetch orders")
+	if err := h.db.WithContext(r.Context()).Find(&orders).Error; err != nil {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to fetch orders"))
 		return
 	}
 
@@ -102,26 +123,41 @@ func (h *OrderHandler) ListOrders(w http.ResponseWriter, r *http.Request) {
 
 // CreateOrder creates a new order
 func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
-	var order shared.Order
-	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
-		shared.WriteErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+	claims, err := shared.AuthenticateRequest(r)
+	if err != nil {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusUnauthorized, shared.ErrCodeUnauthorized, "User not authenticated"))
 		return
 	}
 
-	// Get user ID from context (set by auth middleware)
-	userID, ok := r.Context().Value("user_id").(uint)
-	if !ok {
-		shared.WriteErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+	var req shared.CreateOrderRequest
+	if err := shared.DecodeJSON(r, &req); err != nil {
+		shared.WriteDecodeError(w, r, err)
 		return
 	}
 
-	// Set user ID from context
-	order.UserID = userID
+	order := shared.Order{
+		UserID:      claims.UserID,
+		ProductName: req.ProductName,
+		Quantity:    req.Quantity,
+		TotalPrice:  req.TotalPrice,
+		Status:      shared.OrderStatusPending,
+	}
 
-	if err := h.db.Create(&order).Error; err != nil {
-		shared.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to create order")
+	// The initial status is recorded with the order
+	var event shared.OrderEvent
+	err = h.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&order).Error; err != nil {
+			return err
+		}
+		var err error
+		event, err = recordStatus(tx, order.ID, order.UserID, order.Status)
+		return err
+	})
+	if err != nil {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to create order"))
 		return
 	}
+	h.events.publish(event)
 
 	shared.WriteSuccessResponse(w, http.StatusCreated, "Order created successfully", order)
 }
@@ -129,11 +165,11 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
 // GetOrder returns a specific order
 func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request, orderID uint) {
 	var order shared.Order
-	if err := h.db.First(&order, orderID).Error; err != nil {
+	if err := h.db.WithContext(r.Context()).First(&order, orderID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			shared.WriteErrorResponse(w, http.StatusNotFound, "Order not found")
+			shared.WriteError(w, r, shared.NewAPIError(http.StatusNotFound, shared.ErrCodeOrderNotFound, "Order not found"))
 		} else {
-			shared.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to fetch order")
+			shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to fetch order"))
 		}
 		return
 	}
@@ -141,26 +177,69 @@ func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request, orderID
 	shared.WriteSuccessResponse(w, http.StatusOK, "Order retrieved successfully", order)
 }
 
-// UpdateOrder updates an order
+// UpdateOrder replaces all mutable fields of an order
 func (h *OrderHandler) UpdateOrder(w http.ResponseWriter, r *http.Request, orderID uint) {
+	var req shared.UpdateOrderRequest
+	if err := shared.DecodeJSON(r, &req); err != nil {
+		shared.WriteDecodeError(w, r, err)
+		return
+	}
+
+	h.applyOrderChanges(w, r, orderID, req.Changes())
+}
+
+// PatchOrder updates only the fields present in the request
+func (h *OrderHandler) PatchOrder(w http.ResponseWriter, r *http.Request, orderID uint) {
+	var req shared.PatchOrderRequest
+	if err := shared.DecodeJSON(r, &req); err != nil {
+		shared.WriteDecodeError(w, r, err)
+		return
+	}
+
+	h.applyOrderChanges(w, r, orderID, req.Changes())
+}
+
+// applyOrderChanges writes allowlisted column changes and returns the reloaded order
+func (h *OrderHandler) applyOrderChanges(w http.ResponseWriter, r *http.Request, orderID uint, changes map[string]interface{}) {
 	var order shared.Order
-	if err := h.db.First(&order, orderID).Error; err != nil {
+	if err := h.db.WithContext(r.Context()).First(&order, orderID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			shared.WriteErrorResponse(w, http.StatusNotFound, "Order not found")
+			shared.WriteError(w, r, shared.NewAPIError(http.StatusNotFound, shared.ErrCodeOrderNotFound, "Order not found"))
 		} else {
-			shared.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to fetch order")
+			shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to fetch order"))
 		}
 		return
 	}
 
-	var updateData map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
-		shared.WriteErrorResponse(w, http.StatusBadRequest, "Invalid request body")
-		return
+	if len(changes) > 0 {
+		// Status changes are recorded along with the update
+		status, statusChanged := changes["status"].(string)
+		statusChanged = statusChanged && status != order.Status
+
+		var event shared.OrderEvent
+		err := h.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&order).Updates(changes).Error; err != nil {
+				return err
+			}
+			if !statusChanged {
+				return nil
+			}
+			var err error
+			event, err = recordStatus(tx, order.ID, order.UserID, status)
+			return err
+		})
+		if err != nil {
+			shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to update order"))
+			return
+		}
+		if statusChanged {
+			h.events.publish(event)
+		}
 	}
 
-	if err := h.db.Model(&order).Updates(updateData).Error; err != nil {
-		shared.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to update order")
+	// Reload so the response reflects what was persisted
+	if err := h.db.WithContext(r.Context()).First(&order, orderID).Error; err != nil {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to fetch order"))
 		return
 	}
 
@@ -170,17 +249,17 @@ func (h *OrderHandler) UpdateOrder(w http.ResponseWriter, r *http.Request, order
 // DeleteOrder deletes an order
 func (h *OrderHandler) DeleteOrder(w http.ResponseWriter, r *http.Request, orderID uint) {
 	var order shared.Order
-	if err := h.db.First(&order, orderID).Error; err != nil {
+	if err := h.db.WithContext(r.Context()).First(&order, orderID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			shared.WriteErrorResponse(w, http.StatusNotFound, "Order not found")
+			shared.WriteError(w, r, shared.NewAPIError(http.StatusNotFound, shared.ErrCodeOrderNotFound, "Order not found"))
 		} else {
-			shared.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to fetch order")
+			shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to fetch order"))
 		}
 		return
 	}
 
-	if err := h.db.Delete(&order).Error; err != nil {
-		shared.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to delete order")
+	if err := h.db.WithContext(r.Context()).Delete(&order).Error; err != nil {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to delete order"))
 		return
 	}
 
@@ -29,6 +29,7 @@ func main() {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/orders", orderHandler.HandleOrders)
 	mux.HandleFunc("/orders/", orderHandler.HandleOrder)
+	mux.HandleFunc("/orders/events", orderHandler.HandleOrderEvents)
 	mux.HandleFunc("/orders/user/", orderHandler.GetUserOrders)
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -38,16 +39,19 @@ func main() {
 	// Create server
 	server := &http.Server{
 		Addr:         ":" + config.Port,
-		Handler:      mux,
+		Handler:      shared.DeadlineMiddleware(mux),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
 
+	// End event streams on shutdown so it does not wait for them
+	server.RegisterOnShutdown(orderHandler.Close)
+
 	// Start server in a goroutine
 	go func() {
 		log.Printf("Orders service starting on port %s", config.Port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := shared.ListenAndServe(server, config); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Failed to start server: %v", err)
 		}
 	}()
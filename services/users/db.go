@@ -11,13 +11,13 @@ import (
 
 // initDatabase initializes the database connection and runs migrations
 func initDatabase(databaseURL string) (*gorm.DB, error) {
-	db, err := gorm.Open(sqlite.Open(databaseURL), &gorm.Config{})
+	db, err := gorm.Open(sqlite.Open(databaseURL), &gorm.Config{TranslateError: true})
 	if err != nil {
 		return nil, err
 	}
 
-	// Auto migrate the User model
-	if err := db.AutoMigrate(&shared.User{}); err != nil {
+	// Auto migrate the User and UserInvite models
+	if err := db.AutoMigrate(&shared.User{}, &shared.UserInvite{}); err != nil {
 		return nil, err
 	}
 
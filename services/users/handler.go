@@ -1,16 +1,20 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"go-inventory-system/shared"
 
 	"gorm.io/gorm"
 )
 
+// inviteTTL is how long an invite token can be used to set a password
+const inviteTTL = 72 * time.Hour
+
 // UserHandler handles user-related requests
 type UserHandler struct {
 	db *gorm.DB
@@ -29,22 +33,22 @@ func (h *UserHandler) HandleUsers(w http.ResponseWriter, r *http.Request) {
 	case http.MethodPost:
 		h.CreateUser(w, r)
 	default:
-		shared.WriteErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Method not allowed"))
 	}
 }
 
-// HandleUser handles /users/{id} endpoint (GET, PUT, DELETE)
+// HandleUser handles /users/{id} endpoint (GET, PUT, PATCH, DELETE)
 func (h *UserHandler) HandleUser(w http.ResponseWriter, r *http.Request) {
 	// Extract user ID from URL
 	pathParts := strings.Split(r.URL.Path, "/")
 	if len(pathParts) < 3 {
-		shared.WriteErrorResponse(w, http.StatusBadRequest, "Invalid user ID")
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusBadRequest, shared.ErrCodeBadRequest, "Invalid user ID"))
 		return
 	}
 
 	userID, err := strconv.ParseUint(pathParts[2], 10, 32)
 	if err != nil {
-		shared.WriteErrorResponse(w, http.StatusBadRequest, "Invalid user ID")
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusBadRequest, shared.ErrCodeBadRequest, "Invalid user ID"))
 		return
 	}
 
@@ -53,48 +57,205 @@ func (h *UserHandler) HandleUser(w http.ResponseWriter, r *http.Request) {
 		h.GetUser(w, r, uint(userID))
 	case http.MethodPut:
 		h.UpdateUser(w, r, uint(userID))
+	case http.MethodPatch:
+		h.PatchUser(w, r, uint(userID))
 	case http.MethodDelete:
 		h.DeleteUser(w, r, uint(userID))
 	default:
-		shared.WriteErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Method not allowed"))
 	}
 }
 
 // ListUsers returns all users
 func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
 	var users []shared.User
-	if err := h.db.Find(&users).Error; err != nil {
-		shared.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to fetch users")
+	if err := h.db.WithContext(r.Context()).Find(&users).Error; err != nil {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to fetch users"))
 		return
 	}
 
 	shared.WriteSuccessResponse(w, http.StatusOK, "Users retrieved successfully", users)
 }
 
-// CreateUser creates a new user
+// CreateUser creates a new user on behalf of an admin. The password is hashed
+// before storage; with send_invite the user instead gets a single-use token to
+// set their own.
 func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
-	var user shared.User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		shared.WriteErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+	claims, err := shared.AuthenticateRequest(r)
+	if err != nil {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusUnauthorized, shared.ErrCodeUnauthorized, "User not authenticated"))
+		return
+	}
+	if claims.Role != shared.RoleAdmin {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusForbidden, shared.ErrCodeForbidden, "Admin role required"))
+		return
+	}
+
+	var req shared.CreateUserRequest
+	if err := shared.DecodeJSON(r, &req); err != nil {
+		shared.WriteDecodeError(w, r, err)
+		return
+	}
+
+	if req.SendInvite && req.Password != "" {
+		shared.WriteError(w, r, shared.NewValidationError(shared.FieldError{Field: "password", Message: "must be empty when send_invite is set"}))
+		return
+	}
+	if !req.SendInvite && req.Password == "" {
+		shared.WriteError(w, r, shared.NewValidationError(shared.FieldError{Field: "password", Message: "is required unless send_invite is set"}))
+		return
+	}
+
+	if h.writeConflict(w, r, 0, req.Email, req.Username) {
+		return
+	}
+
+	// Invited users get an unusable random password until they set their own
+	password := req.Password
+	if req.SendInvite {
+		random, err := shared.GenerateRandomString(32)
+		if err != nil {
+			shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to process password"))
+			return
+		}
+		password = random
+	}
+
+	hashedPassword, err := shared.HashPassword(password)
+	if err != nil {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to process password"))
 		return
 	}
 
-	if err := h.db.Create(&user).Error; err != nil {
-		shared.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to create user")
+	role := req.Role
+	if role == "" {
+		role = shared.RoleUser
+	}
+	user := shared.User{
+		Email:    req.Email,
+		Username: req.Username,
+		Password: hashedPassword,
+		Role:     role,
+	}
+	response := shared.CreateUserResponse{}
+
+	err = h.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if !req.SendInvite {
+			return nil
+		}
+
+		token, err := shared.GenerateRandomString(32)
+		if err != nil {
+			return err
+		}
+		invite := shared.UserInvite{
+			UserID:    user.ID,
+			TokenHash: shared.HashToken(token),
+			ExpiresAt: time.Now().Add(inviteTTL),
+		}
+		if err := tx.Create(&invite).Error; err != nil {
+			return err
+		}
+
+		response.InviteToken = token
+		response.InviteExpiresAt = &invite.ExpiresAt
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			shared.WriteError(w, r, shared.NewAPIError(http.StatusConflict, shared.ErrCodeUserExists, "User already exists"))
+		} else {
+			shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to create user"))
+		}
 		return
 	}
 
-	shared.WriteSuccessResponse(w, http.StatusCreated, "User created successfully", user)
+	response.User = user
+	shared.WriteSuccessResponse(w, http.StatusCreated, "User created successfully", response)
+}
+
+// SetPassword sets a user's password using an invite token
+func (h *UserHandler) SetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Method not allowed"))
+		return
+	}
+
+	var req shared.SetPasswordRequest
+	if err := shared.DecodeJSON(r, &req); err != nil {
+		shared.WriteDecodeError(w, r, err)
+		return
+	}
+
+	hashedPassword, err := shared.HashPassword(req.Password)
+	if err != nil {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to process password"))
+		return
+	}
+
+	err = h.db.WithContext(r.Context()).Transaction(func(tx *gorm.DB) error {
+		var invite shared.UserInvite
+		if err := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", shared.HashToken(req.Token), time.Now()).
+			First(&invite).Error; err != nil {
+			return err
+		}
+
+		// Claim the invite first so concurrent requests cannot both use it
+		now := time.Now()
+		result := tx.Model(&invite).Where("used_at IS NULL").Update("used_at", &now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return tx.Model(&shared.User{}).Where("id = ?", invite.UserID).Update("password", hashedPassword).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			shared.WriteError(w, r, shared.NewAPIError(http.StatusBadRequest, shared.ErrCodeInvalidInvite, "Invalid or expired invite token"))
+		} else {
+			shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to set password"))
+		}
+		return
+	}
+
+	shared.WriteSuccessResponse(w, http.StatusOK, "Password set successfully", nil)
+}
+
+// writeConflict writes a 409 response if the email or username is already
+// taken by a user other than excludeID. It reports whether a response was written.
+func (h *UserHandler) writeConflict(w http.ResponseWriter, r *http.Request, excludeID uint, email, username string) bool {
+	var existing shared.User
+	err := h.db.WithContext(r.Context()).Where("(email = ? OR username = ?) AND id <> ?", email, username, excludeID).First(&existing).Error
+	if err == gorm.ErrRecordNotFound {
+		return false
+	}
+	if err != nil {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to check existing users"))
+		return true
+	}
+
+	if existing.Email == email {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusConflict, shared.ErrCodeEmailTaken, "Email is already in use"))
+	} else {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusConflict, shared.ErrCodeUsernameTaken, "Username is already in use"))
+	}
+	return true
 }
 
 // GetUser returns a specific user
 func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request, userID uint) {
 	var user shared.User
-	if err := h.db.First(&user, userID).Error; err != nil {
+	if err := h.db.WithContext(r.Context()).First(&user, userID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			shared.WriteErrorResponse(w, http.StatusNotFound, "User not found")
+			shared.WriteError(w, r, shared.NewAPIError(http.StatusNotFound, shared.ErrCodeUserNotFound, "User not found"))
 		} else {
-			shared.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to fetch user")
+			shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to fetch user"))
 		}
 		return
 	}
@@ -102,26 +263,60 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request, userID uin
 	shared.WriteSuccessResponse(w, http.StatusOK, "User retrieved successfully", user)
 }
 
-// UpdateUser updates a user
+// UpdateUser replaces all mutable fields of a user
 func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request, userID uint) {
+	var req shared.UpdateUserRequest
+	if err := shared.DecodeJSON(r, &req); err != nil {
+		shared.WriteDecodeError(w, r, err)
+		return
+	}
+
+	h.applyUserChanges(w, r, userID, req.Changes())
+}
+
+// PatchUser updates only the fields present in the request
+func (h *UserHandler) PatchUser(w http.ResponseWriter, r *http.Request, userID uint) {
+	var req shared.PatchUserRequest
+	if err := shared.DecodeJSON(r, &req); err != nil {
+		shared.WriteDecodeError(w, r, err)
+		return
+	}
+
+	h.applyUserChanges(w, r, userID, req.Changes())
+}
+
+// applyUserChanges writes allowlisted column changes and returns the reloaded user
+func (h *UserHandler) applyUserChanges(w http.ResponseWriter, r *http.Request, userID uint, changes map[string]interface{}) {
 	var user shared.User
-	if err := h.db.First(&user, userID).Error; err != nil {
+	if err := h.db.WithContext(r.Context()).First(&user, userID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			shared.WriteErrorResponse(w, http.StatusNotFound, "User not found")
+			shared.WriteError(w, r, shared.NewAPIError(http.StatusNotFound, shared.ErrCodeUserNotFound, "User not found"))
 		} else {
-			shared.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to fetch user")
+			shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to fetch user"))
 		}
 		return
 	}
 
-	var updateData map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
-		shared.WriteErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+	email, _ := changes["email"].(string)
+	username, _ := changes["username"].(string)
+	if (email != "" || username != "") && h.writeConflict(w, r, userID, email, username) {
 		return
 	}
 
-	if err := h.db.Model(&user).Updates(updateData).Error; err != nil {
-		shared.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to update user")
+	if len(changes) > 0 {
+		if err := h.db.WithContext(r.Context()).Model(&user).Updates(changes).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				shared.WriteError(w, r, shared.NewAPIError(http.StatusConflict, shared.ErrCodeUserExists, "User already exists"))
+			} else {
+				shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to update user"))
+			}
+			return
+		}
+	}
+
+	// Reload so the response reflects what was persisted
+	if err := h.db.WithContext(r.Context()).First(&user, userID).Error; err != nil {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to fetch user"))
 		return
 	}
 
@@ -131,17 +326,17 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request, userID
 // DeleteUser deletes a user
 func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request, userID uint) {
 	var user shared.User
-	if err := h.db.First(&user, userID).Error; err != nil {
+	if err := h.db.WithContext(r.Context()).First(&user, userID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			shared.WriteErrorResponse(w, http.StatusNotFound, "User not found")
+			shared.WriteError(w, r, shared.NewAPIError(http.StatusNotFound, shared.ErrCodeUserNotFound, "User not found"))
 		} else {
-			shared.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to fetch user")
+			shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to fetch user"))
 		}
 		return
 	}
 
-	if err := h.db.Delete(&user).Error; err != nil {
-		shared.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to delete user")
+	if err := h.db.WithContext(r.Context()).Delete(&user).Error; err != nil {
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to delete user"))
 		return
 	}
 
@@ -151,23 +346,23 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request, userID
 // GetCurrentUser returns the current authenticated user's profile
 func (h *UserHandler) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		shared.WriteErrorResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusMethodNotAllowed, shared.ErrCodeMethodNotAllowed, "Method not allowed"))
 		return
 	}
 
 	// Get user ID from context (set by auth middleware)
 	userID, ok := r.Context().Value("user_id").(uint)
 	if !ok {
-		shared.WriteErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		shared.WriteError(w, r, shared.NewAPIError(http.StatusUnauthorized, shared.ErrCodeUnauthorized, "User not authenticated"))
 		return
 	}
 
 	var user shared.User
-	if err := h.db.First(&user, userID).Error; err != nil {
+	if err := h.db.WithContext(r.Context()).First(&user, userID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			shared.WriteErrorResponse(w, http.StatusNotFound, "User not found")
+			shared.WriteError(w, r, shared.NewAPIError(http.StatusNotFound, shared.ErrCodeUserNotFound, "User not found"))
 		} else {
-			shared.WriteErrorResponse(w, http.StatusInternalServerError, "Failed to fetch user")
+			shared.WriteError(w, r, shared.NewAPIError(http.StatusInternalServerError, shared.ErrCodeInternal, "Failed to fetch user"))
 		}
 		return
 	}
@@ -30,6 +30,7 @@ func main() {
 	mux.HandleFunc("/users", userHandler.HandleUsers)
 	mux.HandleFunc("/users/", userHandler.HandleUser)
 	mux.HandleFunc("/users/me", userHandler.GetCurrentUser)
+	mux.HandleFunc("/users/set-password", userHandler.SetPassword)
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("Users service is healthy"))
@@ -38,7 +39,7 @@ func main() {
 	// Create server
 	server := &http.Server{
 		Addr:         ":" + config.Port,
-		Handler:      mux,
+		Handler:      shared.DeadlineMiddleware(mux),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
@@ -47,7 +48,7 @@ func main() {
 	// Start server in a goroutine
 	go func() {
 		log.Printf("Users service starting on port %s", config.Port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := shared.ListenAndServe(server, config); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Failed to start server: %v", err)
 		}
 	}()
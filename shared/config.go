@@ -3,6 +3,8 @@ package shared
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Config holds application configuration
@@ -12,16 +14,48 @@ type Config struct {
 	JWTSecret   string
 	Environment string
 	LogLevel    string
+	// TLSCertFile and TLSKeyFile hold the service certificate; without
+	// them the service serves plaintext HTTP
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSClientCAFile holds the CA that must have signed client
+	// certificates; without it clients are not asked for one
+	TLSClientCAFile string
+}
+
+// OIDCConfig holds OpenID Connect provider configuration
+type OIDCConfig struct {
+	Issuer         string
+	ClientID       string
+	ClientSecret   string
+	RedirectURIs   []string
+	SigningKeyFile string
+	CodeTTL        time.Duration
 }
 
 // LoadConfig loads configuration from environment variables
 func LoadConfig() *Config {
 	return &Config{
-		Port:        getEnv("PORT", "8080"),
-		DatabaseURL: getEnv("DATABASE_URL", "inventory.db"),
-		JWTSecret:   getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
-		Environment: getEnv("ENVIRONMENT", "development"),
-		LogLevel:    getEnv("LOG_LEVEL", "info"),
+		Port:            getEnv("PORT", "8080"),
+		DatabaseURL:     getEnv("DATABASE_URL", "inventory.db"),
+		JWTSecret:       getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
+		Environment:     getEnv("ENVIRONMENT", "development"),
+		LogLevel:        getEnv("LOG_LEVEL", "info"),
+		TLSCertFile:     os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:      os.Getenv("TLS_KEY_FILE"),
+		TLSClientCAFile: os.Getenv("TLS_CLIENT_CA_FILE"),
+	}
+}
+
+// LoadOIDCConfig loads OpenID Connect configuration from environment variables
+func LoadOIDCConfig() *OIDCConfig {
+	return &OIDCConfig{
+		Issuer:         strings.TrimSuffix(getEnv("OIDC_ISSUER", "http://localhost:8000/auth"), "/"),
+		ClientID:       getEnv("OIDC_CLIENT_ID", "admin-dashboard"),
+		ClientSecret:   getEnv("OIDC_CLIENT_SECRET", ""),
+		RedirectURIs:   getEnvAsList("OIDC_REDIRECT_URIS", []string{"http://localhost:3000/callback"}),
+		SigningKeyFile: getEnv("OIDC_SIGNING_KEY_FILE", ""),
+		CodeTTL:        time.Duration(getEnvAsInt("OIDC_CODE_TTL_SECONDS", 60)) * time.Second,
 	}
 }
 
@@ -42,3 +76,19 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+// getEnvAsList gets a comma-separated environment variable as a list or returns a default value
+func getEnvAsList(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,37 @@
+package shared
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DeadlineHeader carries the number of milliseconds the gateway will wait for
+// a response. Backends should give up on the request once it has passed.
+const DeadlineHeader = "X-Request-Timeout-Ms"
+
+// DeadlineMiddleware bounds the request context by the deadline propagated
+// by the gateway, so database queries are cancelled once nobody is waiting
+func DeadlineMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout, ok := requestTimeout(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestTimeout returns the timeout propagated in the DeadlineHeader
+func requestTimeout(r *http.Request) (time.Duration, bool) {
+	ms, err := strconv.ParseInt(r.Header.Get(DeadlineHeader), 10, 64)
+	if err != nil || ms <= 0 {
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
@@ -0,0 +1,174 @@
+package shared
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// ErrorCode is a stable, machine-readable error identifier. Clients should
+// match on codes rather than on human-readable messages.
+type ErrorCode string
+
+// Generic error codes
+const (
+	ErrCodeBadRequest         ErrorCode = "bad_request"
+	ErrCodeValidationFailed   ErrorCode = "validation_failed"
+	ErrCodeUnauthorized       ErrorCode = "unauthorized"
+	ErrCodeInvalidToken       ErrorCode = "invalid_token"
+	ErrCodeForbidden          ErrorCode = "forbidden"
+	ErrCodeNotFound           ErrorCode = "not_found"
+	ErrCodeMethodNotAllowed   ErrorCode = "method_not_allowed"
+	ErrCodePayloadTooLarge    ErrorCode = "payload_too_large"
+	ErrCodeUnsupportedMedia   ErrorCode = "unsupported_media_type"
+	ErrCodeHeadersTooLarge    ErrorCode = "headers_too_large"
+	ErrCodeConflict           ErrorCode = "conflict"
+	ErrCodeRateLimited        ErrorCode = "rate_limited"
+	ErrCodeInternal           ErrorCode = "internal_error"
+	ErrCodeBadGateway         ErrorCode = "bad_gateway"
+	ErrCodeServiceUnavailable ErrorCode = "service_unavailable"
+	ErrCodeCircuitOpen        ErrorCode = "circuit_open"
+	ErrCodeGatewayTimeout     ErrorCode = "gateway_timeout"
+	ErrCodeInvalidConfig      ErrorCode = "invalid_config"
+)
+
+// Domain error codes
+const (
+	ErrCodeInvalidCredentials ErrorCode = "invalid_credentials"
+	ErrCodeUserExists         ErrorCode = "user_exists"
+	ErrCodeEmailTaken         ErrorCode = "email_taken"
+	ErrCodeUsernameTaken      ErrorCode = "username_taken"
+	ErrCodeUserNotFound       ErrorCode = "user_not_found"
+	ErrCodeInvalidInvite      ErrorCode = "invalid_invite"
+	ErrCodeOrderNotFound      ErrorCode = "order_not_found"
+	ErrCodeUnknownClient      ErrorCode = "unknown_client"
+	ErrCodeInvalidRedirectURI ErrorCode = "invalid_redirect_uri"
+)
+
+const (
+	// ProblemContentType is the media type for RFC 7807 problem details
+	ProblemContentType = "application/problem+json"
+
+	// RequestIDHeader carries the request ID assigned by the gateway
+	RequestIDHeader = "X-Request-ID"
+
+	// problemTypeBase prefixes error codes to form problem type URIs
+	problemTypeBase = "/problems/"
+)
+
+// APIError is a typed API error carrying an HTTP status and a stable code
+type APIError struct {
+	Status int
+	Code   ErrorCode
+	Detail string
+	Fields []FieldError
+}
+
+// NewAPIError creates a new API error
+func NewAPIError(status int, code ErrorCode, detail string) *APIError {
+	return &APIError{Status: status, Code: code, Detail: detail}
+}
+
+// NewValidationError creates an API error for field-level validation failures
+func NewValidationError(fields ...FieldError) *APIError {
+	return &APIError{
+		Status: http.StatusBadRequest,
+		Code:   ErrCodeValidationFailed,
+		Detail: "Validation failed",
+		Fields: fields,
+	}
+}
+
+func (e *APIError) Error() string {
+	return string(e.Code) + ": " + e.Detail
+}
+
+// ProblemDetails is an RFC 7807 problem details response body
+type ProblemDetails struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      ErrorCode    `json:"code"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	TraceID   string       `json:"trace_id,omitempty"`
+}
+
+// WriteError writes an API error. Clients that accept application/problem+json
+// get RFC 7807 problem details; others get the standard APIResponse envelope.
+func WriteError(w http.ResponseWriter, r *http.Request, apiErr *APIError) {
+	requestID := r.Header.Get(RequestIDHeader)
+
+	if acceptsProblemJSON(r) {
+		problem := ProblemDetails{
+			Type:      problemTypeBase + string(apiErr.Code),
+			Title:     http.StatusText(apiErr.Status),
+			Status:    apiErr.Status,
+			Detail:    apiErr.Detail,
+			Instance:  r.URL.Path,
+			Code:      apiErr.Code,
+			Errors:    apiErr.Fields,
+			RequestID: requestID,
+			TraceID:   traceIDFromRequest(r),
+		}
+
+		w.Header().Set("Content-Type", ProblemContentType)
+		w.WriteHeader(apiErr.Status)
+		json.NewEncoder(w).Encode(problem)
+		return
+	}
+
+	WriteJSONResponse(w, apiErr.Status, APIResponse{
+		Success:   false,
+		Error:     apiErr.Detail,
+		Code:      apiErr.Code,
+		Errors:    apiErr.Fields,
+		RequestID: requestID,
+	})
+}
+
+// WriteDecodeError writes the response for an error returned by DecodeJSON
+func WriteDecodeError(w http.ResponseWriter, r *http.Request, err error) {
+	var validationErrs ValidationErrors
+	if errors.As(err, &validationErrs) {
+		WriteError(w, r, NewValidationError(validationErrs...))
+		return
+	}
+
+	if errors.Is(err, ErrBodyTooLarge) {
+		WriteError(w, r, NewAPIError(http.StatusRequestEntityTooLarge, ErrCodePayloadTooLarge, "Request body is too large"))
+		return
+	}
+	if errors.Is(err, ErrJSONTooComplex) {
+		WriteError(w, r, NewAPIError(http.StatusBadRequest, ErrCodeBadRequest, "Request body is too deeply nested or has too many elements"))
+		return
+	}
+
+	WriteError(w, r, NewAPIError(http.StatusBadRequest, ErrCodeBadRequest, "Invalid request body"))
+}
+
+// acceptsProblemJSON checks if the client listed application/problem+json in Accept
+func acceptsProblemJSON(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+			if err == nil && mediaType == ProblemContentType {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// traceIDFromRequest extracts the trace ID from a W3C traceparent header
+func traceIDFromRequest(r *http.Request) string {
+	parts := strings.Split(r.Header.Get("traceparent"), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 {
+		return ""
+	}
+	return parts[1]
+}
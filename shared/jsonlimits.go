@@ -0,0 +1,79 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// MaxJSONBodyBytes bounds request bodies read by DecodeJSON
+const MaxJSONBodyBytes = 1 << 20
+
+// DefaultJSONLimits bounds the shape of documents read by DecodeJSON
+var DefaultJSONLimits = JSONLimits{MaxDepth: 32, MaxElements: 10000}
+
+// ErrBodyTooLarge is returned when a request body exceeds the size limit
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// ErrJSONTooComplex is returned when a JSON document exceeds JSONLimits
+var ErrJSONTooComplex = errors.New("JSON document too deeply nested or too large")
+
+// JSONLimits bounds the shape of a JSON document. Zero values are unlimited.
+type JSONLimits struct {
+	// MaxDepth bounds the nesting of objects and arrays
+	MaxDepth int
+	// MaxElements bounds the number of values in the document, counting
+	// objects, arrays, and every member and element inside them
+	MaxElements int
+}
+
+// CheckJSON scans a JSON document and reports whether it stays within
+// limits, without decoding it. It returns ErrInvalidBody for malformed JSON.
+func CheckJSON(data []byte, limits JSONLimits) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	// open holds the containers being scanned; true for objects
+	var open []bool
+	expectKey := false
+	elements := 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			if len(open) > 0 {
+				return ErrInvalidBody
+			}
+			return nil
+		}
+		if err != nil {
+			return ErrInvalidBody
+		}
+
+		delim, isDelim := token.(json.Delim)
+		if isDelim && (delim == '}' || delim == ']') {
+			open = open[:len(open)-1]
+			expectKey = len(open) > 0 && open[len(open)-1]
+			continue
+		}
+		if expectKey {
+			// Object keys are not values
+			expectKey = false
+			continue
+		}
+
+		elements++
+		if limits.MaxElements > 0 && elements > limits.MaxElements {
+			return ErrJSONTooComplex
+		}
+		if isDelim {
+			open = append(open, delim == '{')
+			if limits.MaxDepth > 0 && len(open) > limits.MaxDepth {
+				return ErrJSONTooComplex
+			}
+			expectKey = delim == '{'
+			continue
+		}
+		expectKey = len(open) > 0 && open[len(open)-1]
+	}
+}
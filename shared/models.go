@@ -12,17 +12,53 @@ type User struct {
 	Email     string    `json:"email" gorm:"unique;not null"`
 	Username  string    `json:"username" gorm:"unique;not null"`
 	Password  string    `json:"-" gorm:"not null"` // Hidden from JSON
+	Role      string    `json:"role" gorm:"not null;default:user"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// UserInvite represents a pending invitation for a user to set their password.
+// Only a hash of the token is stored.
+type UserInvite struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"not null;index"`
+	TokenHash string    `gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// User roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 // UserClaims represents JWT claims for user authentication
 type UserClaims struct {
 	UserID uint   `json:"user_id"`
 	Email  string `json:"email"`
+	Role   string `json:"role,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// IDTokenClaims represents OpenID Connect ID token claims
+type IDTokenClaims struct {
+	UserClaims
+	Nonce             string           `json:"nonce,omitempty"`
+	PreferredUsername string           `json:"preferred_username,omitempty"`
+	AuthTime          *jwt.NumericDate `json:"auth_time,omitempty"`
+}
+
+// Order statuses
+const (
+	OrderStatusPending   = "pending"
+	OrderStatusConfirmed = "confirmed"
+	OrderStatusShipped   = "shipped"
+	OrderStatusDelivered = "delivered"
+	OrderStatusCancelled = "cancelled"
+)
+
 // Order represents an order in the system
 type Order struct {
 	ID          uint      `json:"id" gorm:"primaryKey"`
@@ -35,6 +71,17 @@ type Order struct {
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// OrderEvent records a change of an order's status. Events are numbered in
+// the order they happened, so clients of the status stream can resume after
+// the last event they received.
+type OrderEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	OrderID   uint      `json:"order_id" gorm:"not null;index"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	Status    string    `json:"status" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 // AuthRequest represents login/register request
 type AuthRequest struct {
 	Email    string `json:"email" validate:"required,email"`
@@ -42,6 +89,114 @@ type AuthRequest struct {
 	Username string `json:"username,omitempty" validate:"omitempty,min=3"`
 }
 
+// CreateUserRequest represents an admin request to create a user.
+// Either a password or send_invite must be given.
+type CreateUserRequest struct {
+	Email      string `json:"email" validate:"required,email"`
+	Username   string `json:"username" validate:"required,min=3,max=50"`
+	Password   string `json:"password" validate:"omitempty,min=6"`
+	Role       string `json:"role" validate:"omitempty,oneof=user admin"`
+	SendInvite bool   `json:"send_invite"`
+}
+
+// CreateUserResponse represents the result of creating a user
+type CreateUserResponse struct {
+	User            User       `json:"user"`
+	InviteToken     string     `json:"invite_token,omitempty"`
+	InviteExpiresAt *time.Time `json:"invite_expires_at,omitempty"`
+}
+
+// SetPasswordRequest represents a request to set a password using an invite token
+type SetPasswordRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=6"`
+}
+
+// CreateOrderRequest represents a request to create an order
+type CreateOrderRequest struct {
+	ProductName string  `json:"product_name" validate:"required,max=255"`
+	Quantity    int     `json:"quantity" validate:"required,gt=0"`
+	TotalPrice  float64 `json:"total_price" validate:"required,gt=0"`
+}
+
+// UpdateUserRequest represents a full replacement of a user's mutable fields (PUT)
+type UpdateUserRequest struct {
+	Email    string `json:"email" validate:"required,email"`
+	Username string `json:"username" validate:"required,min=3,max=50"`
+}
+
+// Changes returns the columns to update
+func (req *UpdateUserRequest) Changes() map[string]interface{} {
+	return map[string]interface{}{
+		"email":    req.Email,
+		"username": req.Username,
+	}
+}
+
+// PatchUserRequest represents a partial update of a user (PATCH).
+// Omitted fields are left unchanged.
+type PatchUserRequest struct {
+	Email    *string `json:"email" validate:"email"`
+	Username *string `json:"username" validate:"min=3,max=50"`
+}
+
+// Changes returns the columns to update
+func (req *PatchUserRequest) Changes() map[string]interface{} {
+	changes := make(map[string]interface{})
+	if req.Email != nil {
+		changes["email"] = *req.Email
+	}
+	if req.Username != nil {
+		changes["username"] = *req.Username
+	}
+	return changes
+}
+
+// UpdateOrderRequest represents a full replacement of an order's mutable fields (PUT)
+type UpdateOrderRequest struct {
+	ProductName string  `json:"product_name" validate:"required,max=255"`
+	Quantity    int     `json:"quantity" validate:"required,gt=0"`
+	TotalPrice  float64 `json:"total_price" validate:"required,gt=0"`
+	Status      string  `json:"status" validate:"required,oneof=pending confirmed shipped delivered cancelled"`
+}
+
+// Changes returns the columns to update
+func (req *UpdateOrderRequest) Changes() map[string]interface{} {
+	return map[string]interface{}{
+		"product_name": req.ProductName,
+		"quantity":     req.Quantity,
+		"total_price":  req.TotalPrice,
+		"status":       req.Status,
+	}
+}
+
+// PatchOrderRequest represents a partial update of an order (PATCH).
+// Omitted fields are left unchanged.
+type PatchOrderRequest struct {
+	ProductName *string  `json:"product_name" validate:"min=1,max=255"`
+	Quantity    *int     `json:"quantity" validate:"gt=0"`
+	TotalPrice  *float64 `json:"total_price" validate:"gt=0"`
+	Status      *string  `json:"status" validate:"oneof=pending confirmed shipped delivered cancelled"`
+}
+
+// Changes returns the columns to update
+func (req *PatchOrderRequest) Changes() map[string]interface{} {
+	changes := make(map[string]interface{})
+	if req.ProductName != nil {
+		changes["product_name"] = *req.ProductName
+	}
+	if req.Quantity != nil {
+		changes["quantity"] = *req.Quantity
+	}
+	if req.TotalPrice != nil {
+		changes["total_price"] = *req.TotalPrice
+	}
+	if req.Status != nil {
+		changes["status"] = *req.Status
+	}
+	return changes
+}
+
 // AuthResponse represents login response
 type AuthResponse struct {
 	Token string `json:"token"`
@@ -50,15 +205,296 @@ type AuthResponse struct {
 
 // APIResponse represents a standard API response
 type APIResponse struct {
-	Success bool        `json:"success"`
-	Message string      `json:"message,omitempty"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
+	Success   bool         `json:"success"`
+	Message   string       `json:"message,omitempty"`
+	Data      interface{}  `json:"data,omitempty"`
+	Error     string       `json:"error,omitempty"`
+	Code      ErrorCode    `json:"code,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
 }
 
-// Route represents a gateway route configuration
+// Load balancing strategies
+const (
+	LoadBalanceRoundRobin       = "round_robin"
+	LoadBalanceLeastConnections = "least_connections"
+	LoadBalanceWeighted         = "weighted"
+	LoadBalanceConsistentHash   = "consistent_hash"
+)
+
+// Route represents a gateway route configuration. A route proxies either to
+// a single Backend, to a list of Upstreams, or to weighted Split variants. Path may contain {name}
+// segments that match any single path segment. On Streaming routes, event
+// streams and WebSocket connections are bound by Timeouts.Idle instead of
+// Timeouts.Total.
 type Route struct {
-	Path    string   `yaml:"path"`
-	Backend string   `yaml:"backend"`
-	Methods []string `yaml:"methods"`
+	// Name identifies the route in metrics and the admin API (default: Path).
+	// Routes sharing a path must be named.
+	Name           string         `yaml:"name,omitempty"`
+	Path           string         `yaml:"path"`
+	Match          RouteMatch     `yaml:"match,omitempty"`
+	Backend        string         `yaml:"backend,omitempty"`
+	Upstreams      []Upstream     `yaml:"upstreams,omitempty"`
+	LoadBalancing  LoadBalancing  `yaml:"load_balancing,omitempty"`
+	HealthCheck    HealthCheck    `yaml:"health_check,omitempty"`
+	CircuitBreaker CircuitBreaker `yaml:"circuit_breaker,omitempty"`
+	Retry          RetryPolicy    `yaml:"retry,omitempty"`
+	Timeouts       RouteTimeouts  `yaml:"timeouts,omitempty"`
+	Rewrite        Rewrite        `yaml:"rewrite,omitempty"`
+	Split          TrafficSplit   `yaml:"split,omitempty"`
+	Mirror         Mirror         `yaml:"mirror,omitempty"`
+	Cache          CachePolicy    `yaml:"cache,omitempty"`
+	Coalesce       bool           `yaml:"coalesce,omitempty"`
+	Streaming      bool           `yaml:"streaming,omitempty"`
+	CORS           CORSPolicy     `yaml:"cors,omitempty"`
+	Limits         RequestLimits  `yaml:"limits,omitempty"`
+	TLS            UpstreamTLS    `yaml:"tls,omitempty"`
+	Methods        []string       `yaml:"methods"`
+}
+
+// ID returns the name identifying the route
+func (r Route) ID() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.Path
+}
+
+// RouteMatch narrows a route to requests with a given host, headers or query
+// parameters. A header or query value of "*" only requires it to be present.
+type RouteMatch struct {
+	// Host is matched case-insensitively, ignoring the port. A leading
+	// "*." matches any subdomain.
+	Host    string            `yaml:"host,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+	Query   map[string]string `yaml:"query,omitempty"`
+}
+
+// Upstream represents one backend instance of a route
+type Upstream struct {
+	URL    string `yaml:"url"`
+	Weight int    `yaml:"weight,omitempty"`
+}
+
+// LoadBalancing configures how requests are spread across a route's upstreams
+type LoadBalancing struct {
+	// Strategy is one of round_robin (default), least_connections, weighted or consistent_hash
+	Strategy string `yaml:"strategy,omitempty"`
+	// HashHeader is the request header hashed by consistent_hash. When empty
+	// the authenticated user ID is used.
+	HashHeader string `yaml:"hash_header,omitempty"`
+}
+
+// HealthCheck configures active and passive health checking of a route's upstreams
+type HealthCheck struct {
+	// Path is probed on each upstream by active checks (default /health)
+	Path string `yaml:"path,omitempty"`
+	// Interval between active probes; zero disables active checks
+	Interval time.Duration `yaml:"interval,omitempty"`
+	// Timeout for each probe (default 2s)
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// HealthyThreshold is the number of consecutive successful probes
+	// before an ejected upstream is reintroduced (default 2)
+	HealthyThreshold int `yaml:"healthy_threshold,omitempty"`
+	// UnhealthyThreshold is the number of consecutive failed probes
+	// before an upstream is ejected (default 3)
+	UnhealthyThreshold int `yaml:"unhealthy_threshold,omitempty"`
+	// MaxFailures is the number of consecutive failed proxied requests
+	// before an upstream is passively ejected; zero disables passive checks
+	MaxFailures int `yaml:"max_failures,omitempty"`
+	// EjectDuration is how long a passively ejected upstream stays out of
+	// rotation when active checks are disabled (default 30s)
+	EjectDuration time.Duration `yaml:"eject_duration,omitempty"`
+}
+
+// CircuitBreaker configures a circuit breaker for each upstream of a route.
+// The breaker opens when the failure or slow call rate over the window crosses
+// its threshold, fails fast while open, and lets a few trial requests through
+// once OpenDuration has passed.
+type CircuitBreaker struct {
+	Enabled bool `yaml:"enabled"`
+	// FailureRateThreshold is the percentage of failed calls that opens the breaker (default 50)
+	FailureRateThreshold float64 `yaml:"failure_rate_threshold,omitempty"`
+	// SlowCallDuration marks calls slower than this as slow; zero disables latency tracking
+	SlowCallDuration time.Duration `yaml:"slow_call_duration,omitempty"`
+	// SlowCallRateThreshold is the percentage of slow calls that opens the breaker (default 100)
+	SlowCallRateThreshold float64 `yaml:"slow_call_rate_threshold,omitempty"`
+	// MinimumRequests in the window before rates are evaluated (default 10)
+	MinimumRequests int `yaml:"minimum_requests,omitempty"`
+	// Window is the sliding window over which rates are computed (default 30s)
+	Window time.Duration `yaml:"window,omitempty"`
+	// OpenDuration is how long the breaker stays open before trial requests (default 30s)
+	OpenDuration time.Duration `yaml:"open_duration,omitempty"`
+	// HalfOpenRequests is the number of trial requests that must succeed to close the breaker (default 3)
+	HalfOpenRequests int `yaml:"half_open_requests,omitempty"`
+	// FailureStatuses lists the response status codes counted as failures (default: every 5xx).
+	// Connection errors and timeouts always count.
+	FailureStatuses []int `yaml:"failure_statuses,omitempty"`
+}
+
+// RetryPolicy configures retries of failed requests to a route. Only
+// idempotent methods, or requests carrying an Idempotency-Key header, are
+// retried. Retries also draw from the gateway-wide retry budget.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first; 0 or 1 disables retries
+	MaxAttempts int `yaml:"max_attempts,omitempty"`
+	// RetryOn lists the response status codes that are retried (default 502, 503, 504).
+	// Connection errors are always retried.
+	RetryOn []int `yaml:"retry_on,omitempty"`
+	// Backoff is the base delay before the first retry, doubled on each attempt (default 25ms)
+	Backoff time.Duration `yaml:"backoff,omitempty"`
+	// MaxBackoff caps the delay between attempts (default 250ms)
+	MaxBackoff time.Duration `yaml:"max_backoff,omitempty"`
+	// MaxBodyBytes is the largest request body buffered for replay; larger
+	// requests are not retried (default 64KB)
+	MaxBodyBytes int64 `yaml:"max_body_bytes,omitempty"`
+}
+
+// RouteTimeouts bounds how long the gateway waits on a route's upstreams.
+// Zero values leave the corresponding timeout unset.
+type RouteTimeouts struct {
+	// Connect bounds establishing a connection to an upstream
+	Connect time.Duration `yaml:"connect,omitempty"`
+	// Response bounds the wait for response headers on each attempt
+	Response time.Duration `yaml:"response,omitempty"`
+	// Total bounds the whole request, including retries and streaming the
+	// response body. It does not apply to event streams and WebSockets on
+	// streaming routes.
+	Total time.Duration `yaml:"total,omitempty"`
+	// Idle closes event streams and WebSocket connections on streaming
+	// routes after this long without traffic (default 60s)
+	Idle time.Duration `yaml:"idle,omitempty"`
+}
+
+// Rewrite configures how a route's public path maps to the backend path.
+// By default the path is forwarded unchanged. When several rules are set
+// the regex is applied first, then the prefix is stripped, then added.
+type Rewrite struct {
+	// StripPrefix removes the route path from the start of the request path
+	StripPrefix bool `yaml:"strip_prefix,omitempty"`
+	// AddPrefix is prepended to the request path
+	AddPrefix string `yaml:"add_prefix,omitempty"`
+	// Regex is matched against the request path; when it matches, the path
+	// is replaced by Replacement, which may refer to capture groups as $1 or ${name}
+	Regex       string `yaml:"regex,omitempty"`
+	Replacement string `yaml:"replacement,omitempty"`
+}
+
+// Mirror copies a route's requests to a secondary backend in the background.
+// Mirrored responses are discarded and only compared in metrics; mirrored
+// requests carry an X-Mirrored-Request header.
+type Mirror struct {
+	// URL of the backend receiving the copies; empty disables mirroring
+	URL string `yaml:"url,omitempty"`
+	// Percentage of requests mirrored (default 100)
+	Percentage float64 `yaml:"percentage,omitempty"`
+	// Timeout for each mirrored request (default 5s)
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// MaxBodyBytes is the largest request body copied; larger requests are
+	// not mirrored (default 64KB)
+	MaxBodyBytes int64 `yaml:"max_body_bytes,omitempty"`
+}
+
+// CachePolicy configures caching of a route's GET responses in the gateway.
+// Backends control caching with Cache-Control, Expires, ETag, Last-Modified
+// and Vary; the policy fills in and bounds what they send.
+type CachePolicy struct {
+	Enabled bool `yaml:"enabled"`
+	// TTL applies to responses without an explicit lifetime; zero caches only
+	// responses that set one
+	TTL time.Duration `yaml:"ttl,omitempty"`
+	// MaxTTL caps the lifetime of any cached response; zero means no cap
+	MaxTTL time.Duration `yaml:"max_ttl,omitempty"`
+	// PerUser caches authenticated responses separately for each user.
+	// Without it, authenticated requests bypass the cache.
+	PerUser bool `yaml:"per_user,omitempty"`
+}
+
+// CORSPolicy configures cross-origin access to a route. The gateway answers
+// preflight requests itself and replaces any CORS headers from backends.
+// Routes without allowed origins send no CORS headers.
+type CORSPolicy struct {
+	// AllowedOrigins are exact origins, "*" for any origin, or patterns
+	// such as "https://*.example.com" matching any subdomain
+	AllowedOrigins []string `yaml:"allowed_origins,omitempty"`
+	// AllowedMethods defaults to the route's methods
+	AllowedMethods []string `yaml:"allowed_methods,omitempty"`
+	// AllowedHeaders defaults to Content-Type and Authorization; "*"
+	// allows any request header
+	AllowedHeaders   []string      `yaml:"allowed_headers,omitempty"`
+	ExposedHeaders   []string      `yaml:"exposed_headers,omitempty"`
+	AllowCredentials bool          `yaml:"allow_credentials,omitempty"`
+	MaxAge           time.Duration `yaml:"max_age,omitempty"`
+}
+
+// RequestLimits bounds the requests a route accepts. The gateway rejects
+// requests exceeding them before they reach the backend.
+type RequestLimits struct {
+	// MaxBodyBytes defaults to the gateway's limit
+	MaxBodyBytes   int64 `yaml:"max_body_bytes,omitempty"`
+	MaxHeaderBytes int   `yaml:"max_header_bytes,omitempty"`
+	// ContentTypes lists the media types accepted for request bodies
+	ContentTypes []string `yaml:"content_types,omitempty"`
+	// MaxJSONDepth and MaxJSONElements bound the shape of JSON bodies
+	MaxJSONDepth    int `yaml:"max_json_depth,omitempty"`
+	MaxJSONElements int `yaml:"max_json_elements,omitempty"`
+}
+
+// UpstreamTLS configures how the gateway connects to a route's https
+// upstreams. With a certificate set the gateway authenticates itself to
+// backends that require client certificates.
+type UpstreamTLS struct {
+	// CAFile holds the CA certificates trusted for upstreams (default: the system roots)
+	CAFile string `yaml:"ca_file,omitempty"`
+	// CertFile and KeyFile hold the client certificate the gateway presents
+	CertFile string `yaml:"cert_file,omitempty"`
+	KeyFile  string `yaml:"key_file,omitempty"`
+	// ServerName overrides the name upstream certificates are verified against
+	ServerName string `yaml:"server_name,omitempty"`
+}
+
+// Sticky assignment modes for traffic splits
+const (
+	StickyNone   = ""
+	StickyUser   = "user"
+	StickyCookie = "cookie"
+)
+
+// TrafficSplit divides a route's traffic between variants, for example to
+// send a small share to a canary release. Each variant has its own upstreams;
+// the route's other settings apply to all of them.
+type TrafficSplit struct {
+	Variants []Variant `yaml:"variants,omitempty"`
+	// Sticky keeps a client on one variant: "user" hashes the authenticated
+	// user ID, "cookie" remembers the variant in a cookie
+	Sticky string `yaml:"sticky,omitempty"`
+	// Cookie names the cookie used by cookie stickiness (default gw_variant_<route>)
+	Cookie string `yaml:"cookie,omitempty"`
+	// OverrideHeader names a request header that forces a variant by name (default X-Variant)
+	OverrideHeader string `yaml:"override_header,omitempty"`
+}
+
+// Variant is one backend group of a traffic split
+type Variant struct {
+	Name string `yaml:"name"`
+	// Weight is the variant's share of traffic relative to the other variants
+	Weight    int        `yaml:"weight"`
+	Backend   string     `yaml:"backend,omitempty"`
+	Upstreams []Upstream `yaml:"upstreams,omitempty"`
+}
+
+// AllUpstreams returns the variant's upstreams, treating Backend as a single upstream
+func (v Variant) AllUpstreams() []Upstream {
+	return Route{Backend: v.Backend, Upstreams: v.Upstreams}.AllUpstreams()
+}
+
+// AllUpstreams returns the route's upstreams, treating Backend as a single upstream
+func (r Route) AllUpstreams() []Upstream {
+	if len(r.Upstreams) > 0 {
+		return r.Upstreams
+	}
+	if r.Backend != "" {
+		return []Upstream{{URL: r.Backend}}
+	}
+	return nil
 }
@@ -0,0 +1,60 @@
+package shared
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// ServerTLSConfig creates the TLS configuration of a service, or returns nil
+// if the service serves plaintext HTTP. With a client CA configured, only
+// clients presenting a certificate signed by it can connect.
+func ServerTLSConfig(config *Config) (*tls.Config, error) {
+	if config.TLSCertFile == "" && config.TLSKeyFile == "" {
+		if config.TLSClientCAFile != "" {
+			return nil, errors.New("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE")
+		}
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(config.TLSCertFile, config.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if config.TLSClientCAFile != "" {
+		caPEM, err := os.ReadFile(config.TLSClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read client CA file: %w", err)
+		}
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in %s", config.TLSClientCAFile)
+		}
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsConfig, nil
+}
+
+// ListenAndServe serves HTTPS if the config has a certificate and plaintext
+// HTTP otherwise
+func ListenAndServe(server *http.Server, config *Config) error {
+	tlsConfig, err := ServerTLSConfig(config)
+	if err != nil {
+		return err
+	}
+	if tlsConfig == nil {
+		return server.ListenAndServe()
+	}
+
+	server.TLSConfig = tlsConfig
+	return server.ListenAndServeTLS("", "")
+}
@@ -2,7 +2,9 @@ package shared
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"net/http"
 	"strings"
@@ -30,10 +32,11 @@ func CheckPassword(password, hash string) bool {
 }
 
 // GenerateJWT generates a JWT token for a user
-func GenerateJWT(userID uint, email string) (string, error) {
+func GenerateJWT(userID uint, email, role string) (string, error) {
 	claims := UserClaims{
 		UserID: userID,
 		Email:  email,
+		Role:   role,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(JWTExpiry)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -77,6 +80,15 @@ func ExtractTokenFromHeader(r *http.Request) (string, error) {
 	return parts[1], nil
 }
 
+// AuthenticateRequest returns the claims of the bearer token a request carries
+func AuthenticateRequest(r *http.Request) (*UserClaims, error) {
+	token, err := ExtractTokenFromHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	return ValidateJWT(token)
+}
+
 // GenerateRandomString generates a random string of specified length
 func GenerateRandomString(length int) (string, error) {
 	bytes := make([]byte, length)
@@ -87,6 +99,13 @@ func GenerateRandomString(length int) (string, error) {
 	return base64.URLEncoding.EncodeToString(bytes)[:length], nil
 }
 
+// HashToken returns the SHA-256 hex digest of a token, for storing
+// single-use tokens without keeping them in plain text
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 // WriteJSONResponse writes a JSON response with proper headers
 func WriteJSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -94,15 +113,6 @@ func WriteJSONResponse(w http.ResponseWriter, statusCode int, data interface{})
 	json.NewEncoder(w).Encode(data)
 }
 
-// WriteErrorResponse writes an error response in JSON format
-func WriteErrorResponse(w http.ResponseWriter, statusCode int, message string) {
-	response := APIResponse{
-		Success: false,
-		Error:   message,
-	}
-	WriteJSONResponse(w, statusCode, response)
-}
-
 // WriteSuccessResponse writes a success response in JSON format
 func WriteSuccessResponse(w http.ResponseWriter, statusCode int, message string, data interface{}) {
 	response := APIResponse{
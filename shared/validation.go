@@ -0,0 +1,241 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldError describes a validation failure for a single field
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors is a list of field-level validation failures
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	messages := make([]string, len(v))
+	for i, fe := range v {
+		messages[i] = fe.Field + " " + fe.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// ErrInvalidBody is returned when a request body is not valid JSON
+var ErrInvalidBody = errors.New("invalid request body")
+
+// DecodeJSON decodes a JSON request body into dst, rejecting unknown fields,
+// and validates the result against its `validate` struct tags. Bodies larger
+// than MaxJSONBodyBytes or exceeding DefaultJSONLimits are rejected before
+// decoding.
+func DecodeJSON(r *http.Request, dst interface{}) error {
+	data, err := io.ReadAll(io.LimitReader(r.Body, MaxJSONBodyBytes+1))
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return ErrBodyTooLarge
+		}
+		return ErrInvalidBody
+	}
+	if len(data) > MaxJSONBodyBytes {
+		return ErrBodyTooLarge
+	}
+	if err := CheckJSON(data, DefaultJSONLimits); err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(dst); err != nil {
+		return decodeError(err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return ErrInvalidBody
+	}
+
+	return Validate(dst)
+}
+
+// decodeError converts a JSON decoding error into field errors where possible
+func decodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return ValidationErrors{{Field: typeErr.Field, Message: "must be of type " + typeErr.Type.String()}}
+	}
+
+	// encoding/json reports unknown fields only as a formatted message
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return ValidationErrors{{Field: strings.Trim(field, `"`), Message: "is not allowed"}}
+	}
+
+	return ErrInvalidBody
+}
+
+// Validate checks a struct against its `validate` tags. Supported rules are
+// required, omitempty, email, min, max, gt, gte, lt, lte and oneof. For strings
+// min and max apply to the length; for numbers they apply to the value.
+// Nil pointer fields are treated as absent.
+func Validate(v interface{}) error {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var errs ValidationErrors
+	validateStruct(value, &errs)
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validateStruct validates each tagged field of a struct value
+func validateStruct(value reflect.Value, errs *ValidationErrors) {
+	valueType := value.Type()
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			validateStruct(value.Field(i), errs)
+			continue
+		}
+
+		tag := field.Tag.Get("validate")
+		if tag == "" || tag == "-" {
+			continue
+		}
+
+		if message := validateField(value.Field(i), tag); message != "" {
+			*errs = append(*errs, FieldError{Field: jsonFieldName(field), Message: message})
+		}
+	}
+}
+
+// validateField applies comma-separated rules to a field and returns the first failure
+func validateField(value reflect.Value, tag string) string {
+	rules := strings.Split(tag, ",")
+
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			for _, rule := range rules {
+				if rule == "required" {
+					return "is required"
+				}
+			}
+			return ""
+		}
+		value = value.Elem()
+	}
+
+	for _, rule := range rules {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "omitempty":
+			if value.IsZero() {
+				return ""
+			}
+		case "required":
+			if value.IsZero() {
+				return "is required"
+			}
+		case "email":
+			if _, err := mail.ParseAddress(value.String()); err != nil || strings.ContainsAny(value.String(), "<> ") {
+				return "must be a valid email address"
+			}
+		case "min", "max", "gt", "gte", "lt", "lte":
+			if message := compare(value, name, param); message != "" {
+				return message
+			}
+		case "oneof":
+			if !containsString(strings.Fields(param), fmt.Sprint(value.Interface())) {
+				return "must be one of: " + strings.Join(strings.Fields(param), ", ")
+			}
+		}
+	}
+	return ""
+}
+
+// compare checks a size or value constraint on strings, numbers and slices
+func compare(value reflect.Value, rule, param string) string {
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return ""
+	}
+
+	// unit names what a length is counted in; numbers have none
+	var actual float64
+	unit := ""
+	switch value.Kind() {
+	case reflect.String:
+		actual, unit = float64(utf8.RuneCountInString(value.String())), "characters"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		actual, unit = float64(value.Len()), "items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		actual = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		actual = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		actual = value.Float()
+	default:
+		return ""
+	}
+
+	ok := true
+	switch rule {
+	case "min", "gte":
+		ok = actual >= limit
+	case "max", "lte":
+		ok = actual <= limit
+	case "gt":
+		ok = actual > limit
+	case "lt":
+		ok = actual < limit
+	}
+	if ok {
+		return ""
+	}
+
+	comparisons := map[string]string{
+		"min": "at least", "gte": "at least",
+		"max": "at most", "lte": "at most",
+		"gt": "greater than", "lt": "less than",
+	}
+	if unit != "" {
+		return fmt.Sprintf("must be %s %s %s", comparisons[rule], param, unit)
+	}
+	return fmt.Sprintf("must be %s %s", comparisons[rule], param)
+}
+
+// jsonFieldName returns the name a struct field uses in JSON
+func jsonFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+// containsString checks if a slice contains a string
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}